@@ -0,0 +1,86 @@
+package agents
+
+import (
+	"ai-dag/config"
+	"ai-dag/utils"
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestRequestErrorsHideSecret(t *testing.T) {
+	transport := utils.HTTPClient.Transport
+	utils.HTTPClient.Transport = failingTransport{}
+	defer func() { utils.HTTPClient.Transport = transport }()
+
+	ctx := WithSecret(context.Background(), "s3cret")
+	tests := map[string]Agent{
+		"weatherForecast": NewWeatherForecast(WeatherForecastParams{Lat: 1, Lon: 2}),
+		"nearBySearch":    NewNearBySearch(NewNearBySearchRequest(config.Location{Lat: 1, Lng: 2}, 100, "cafe", "")),
+	}
+	for name, agent := range tests {
+		_, err := agent.Do(ctx, &config.DagConfig{}, "node", nil)
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		} else if strings.Contains(err.Error(), "s3cret") {
+			t.Errorf("%s: secret in error %q", name, err)
+		}
+	}
+}
+
+func TestWeatherForecastURL(t *testing.T) {
+	tests := []struct {
+		params WeatherForecastParams
+		want   string
+	}{
+		{
+			WeatherForecastParams{Lat: 1.5, Lon: -2, Units: "metric", Lang: "en"},
+			"https://api.openweathermap.org/data/3.0/onecall?lat=1.500000&lon=-2.000000&appid=KEY&lang=en&units=metric",
+		},
+		{
+			WeatherForecastParams{Lat: 1.5, Lon: -2, Units: "metric", Lang: "en", Exclude: "minutely,hourly"},
+			"https://api.openweathermap.org/data/3.0/onecall?lat=1.500000&lon=-2.000000&appid=KEY&lang=en&units=metric&exclude=minutely,hourly",
+		},
+	}
+	for _, test := range tests {
+		if got := NewWeatherForecast(test.params).url("KEY"); got != test.want {
+			t.Errorf("got %s, want %s", got, test.want)
+		}
+	}
+}
+
+func TestOpenAICallParams(t *testing.T) {
+	agent, err := DefaultRegistry.New(config.AgentConfig{
+		Type: "openAICall",
+		Params: map[string]interface{}{
+			"model":    "gpt-4",
+			"messages": []interface{}{map[string]interface{}{"role": "user", "content": "Hi {{.a}}"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := OpenAICallParams{
+		URL:      "https://api.openai.com/v1/chat/completions",
+		Method:   "POST",
+		Model:    "gpt-4",
+		Messages: []config.Message{{Role: "user", Content: "Hi {{.a}}"}},
+	}
+	if got := agent.(*OpenAICall).params; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	_, err = DefaultRegistry.New(config.AgentConfig{Type: "openAICall", Params: map[string]interface{}{"model": "gpt-4"}})
+	if err == nil || !strings.Contains(err.Error(), "messages") {
+		t.Errorf("got error %v, want messages reported as required", err)
+	}
+}
@@ -2,25 +2,29 @@ package agents
 
 import (
 	"ai-dag/config"
-	"fmt"
+	"context"
 )
 
 type AnalyzeCryptoSentiment struct {
 }
 
+func init() {
+	Register("analyzeCryptoSentiment", func(config.AgentConfig) (Agent, error) {
+		return NewAnalyzeCryptoSentiment(), nil
+	})
+}
+
 func NewAnalyzeCryptoSentiment() *AnalyzeCryptoSentiment {
 	return &AnalyzeCryptoSentiment{}
 }
 
 func (a *AnalyzeCryptoSentiment) Do(
+	ctx context.Context,
 	config *config.DagConfig,
 	agentId string,
-	resultCh map[string]chan string,
-	childResults map[string]string,
-) {
-	fmt.Printf("analyzeCryptoSentiment: %s\n", agentId)
+	childResults map[string]interface{},
+) (*Output, error) {
 	// TODO: Mock implementation
 	// you know what to do
-	resultCh[agentId] <- "Sentiment: positive"
-	close(resultCh[agentId])
+	return TextOutput("Sentiment: positive"), nil
 }
@@ -2,25 +2,29 @@ package agents
 
 import (
 	"ai-dag/config"
-	"fmt"
+	"context"
 )
 
 type FetchCryptoMentions struct {
 }
 
+func init() {
+	Register("fetchCryptoMentions", func(config.AgentConfig) (Agent, error) {
+		return NewFetchCryptoMentions(), nil
+	})
+}
+
 func NewFetchCryptoMentions() *FetchCryptoMentions {
 	return &FetchCryptoMentions{}
 }
 
 func (f FetchCryptoMentions) Do(
+	ctx context.Context,
 	config *config.DagConfig,
 	agentId string,
-	resultCh map[string]chan string,
-	childResults map[string]string,
-) {
-	fmt.Printf("fetchCryptoMentions: %s\n", agentId)
+	childResults map[string]interface{},
+) (*Output, error) {
 	// TODO: Mock implementation
 	// you know what to do
-	resultCh[agentId] <- "BTC, ETH, SOL"
-	close(resultCh[agentId])
+	return JSONOutput([]string{"BTC", "ETH", "SOL"}), nil
 }
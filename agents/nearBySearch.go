@@ -3,12 +3,12 @@ package agents
 import (
 	"ai-dag/config"
 	"ai-dag/utils"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
 )
 
 type NearBySearchResponse struct {
@@ -58,7 +58,8 @@ type NearBySearchResponse struct {
 		UserRatingsTotal int      `json:"user_ratings_total"`
 		Vicinity         string   `json:"vicinity"`
 	} `json:"results"`
-	Status string `json:"status"`
+	Status       string `json:"status"`
+	ErrorMessage string `json:"error_message,omitempty"`
 }
 
 type NearBySearchRequest struct {
@@ -89,21 +90,50 @@ func NewNearBySearch(nearBySearchRequest *NearBySearchRequest) *NearBySearch {
 	return &NearBySearch{NearBySearchRequest: nearBySearchRequest}
 }
 
-func (n *NearBySearch) toUrl() string {
-	googleAPIKey := os.Getenv("GOOGLE_API_KEY")
-	if googleAPIKey == "" {
-		log.Println("GOOGLE_API_KEY not set")
-		return ""
-	}
+// NearBySearchParams are the `params:` of nearBySearch nodes.
+type NearBySearchParams struct {
+	Location config.Location `param:"location,required"`
+	Radius   int             `param:"radius,required"`
+	Type     string          `param:"type" default:"restaurant"`
+}
+
+func init() {
+	Register("nearBySearch", func(agentConfig config.AgentConfig) (Agent, error) {
+		var params NearBySearchParams
+		if err := DecodeParams(agentConfig.Params, &params); err != nil {
+			return nil, err
+		}
+		request := NewNearBySearchRequest(params.Location, params.Radius, params.Type, "")
+		return NewNearBySearch(request), nil
+	}, "secret")
+	RegisterParams("nearBySearch", NearBySearchParams{})
+}
+
+func (n *NearBySearch) urlWithKey(key string) string {
 	return "https://maps.googleapis.com/maps/api/place/nearbysearch/json?location=" +
 		fmt.Sprintf("%f,%f", n.Location.Lat, n.Location.Lng) + "&radius=" +
-		fmt.Sprintf("%d", n.Radius) + "&type=" + n.Type + "&key=" + googleAPIKey
+		fmt.Sprintf("%d", n.Radius) + "&type=" + n.Type + "&key=" + key
+}
+
+// Plan shows the request URL with the API key masked
+func (n *NearBySearch) Plan(
+	config *config.DagConfig,
+	agentId string,
+	inputs []string,
+) ([]Detail, error) {
+	return []Detail{{Name: "url", Value: "GET " + n.urlWithKey(maskedSecret)}}, nil
 }
 
-func get(url string, target interface{}) error {
-	resp, err := http.Get(url)
+// get fetches url and decodes its JSON body into target. Errors never
+// quote the query string, which holds the API key.
+func get(ctx context.Context, url string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return err
+		return utils.RedactURL(err)
+	}
+	resp, err := utils.HTTPClient.Do(req)
+	if err != nil {
+		return utils.RedactURL(err)
 	}
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
@@ -112,22 +142,31 @@ func get(url string, target interface{}) error {
 		}
 	}(resp.Body)
 
+	if err := utils.CheckResponse(resp, nil); err != nil {
+		return err
+	}
 	return json.NewDecoder(resp.Body).Decode(target)
 }
 
 // Do Add Do method
 func (n *NearBySearch) Do(
+	ctx context.Context,
 	config *config.DagConfig,
 	agentId string,
-	resultCh map[string]chan string,
-	childResults map[string]string,
-) {
+	childResults map[string]interface{},
+) (*Output, error) {
+	key, err := Secret(ctx)
+	if err != nil {
+		return nil, err
+	}
 	var response NearBySearchResponse
-	err := get(n.toUrl(), &response)
+	err = get(ctx, n.urlWithKey(key), &response)
 	if err != nil {
-		return
+		return nil, fmt.Errorf("nearby search request failed: %w", err)
+	}
+	// The Places API reports most failures with a 200 and a non-OK status
+	if response.Status != "OK" && response.Status != "ZERO_RESULTS" {
+		return nil, fmt.Errorf("nearby search returned %s: %s", response.Status, response.ErrorMessage)
 	}
-	jsonStr := utils.ToPrettyJsonFromObject(response)
-	resultCh[agentId] <- jsonStr
-	close(resultCh[agentId])
+	return JSONOutput(response), nil
 }
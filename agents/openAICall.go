@@ -3,68 +3,66 @@ package agents
 import (
 	"ai-dag/config"
 	"ai-dag/llm"
+	"ai-dag/utils"
 	"context"
 	"fmt"
-	"html/template"
-	"os"
 	"strings"
+	"text/template"
 )
 
-type OpenAICall struct{}
+type OpenAICall struct {
+	params OpenAICallParams
+}
+
+// OpenAICallParams are the `params:` of openAICall nodes. The content of
+// each message is a template over the node's children.
+type OpenAICallParams struct {
+	URL      string           `param:"url" default:"https://api.openai.com/v1/chat/completions"`
+	Method   string           `param:"method" default:"POST"`
+	Model    string           `param:"model,required"`
+	Messages []config.Message `param:"messages,required"`
+}
+
+func init() {
+	Register("openAICall", func(agentConfig config.AgentConfig) (Agent, error) {
+		var params OpenAICallParams
+		if err := DecodeParams(agentConfig.Params, &params); err != nil {
+			return nil, err
+		}
+		return NewOpenAICall(params), nil
+	}, "secret")
+	RegisterParams("openAICall", OpenAICallParams{})
+}
 
-func NewOpenAICall() *OpenAICall {
-	return &OpenAICall{}
+func NewOpenAICall(params OpenAICallParams) *OpenAICall {
+	return &OpenAICall{params: params}
 }
 
 func (o *OpenAICall) Do(
+	ctx context.Context,
 	dagConfig *config.DagConfig,
 	agentId string,
-	resultCh map[string]chan string,
-	childrenResults map[string]string,
-) {
-	// Create a new GPTChat instance
-	key := os.Getenv("OPENAI_API_KEY")
-	if key == "" {
-		fmt.Println("OPENAI_API_KEY not set")
-		return
+	childrenResults map[string]interface{},
+) (*Output, error) {
+	key, err := Secret(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	t := dagConfig.Agents[agentId]
-
-	// Create a new llm configuration from the agents configuration
+	// Create a new llm configuration from the node's params
 	chatConfig := config.ChatConfig{
-		Model: t.Model,
+		Model:         o.params.Model,
+		RequestURL:    o.params.URL,
+		RequestMethod: o.params.Method,
 	}
 
-	// Add each message from the agents configuration to the llm configuration
-
-	for _, message := range t.Messages {
-		parse, err := template.New("content").Parse(message.Content)
-		if err != nil {
-			fmt.Printf("Failed to parse the message content: %s\n", err)
-			return
-		}
-		strBuilder := &strings.Builder{}
-
-		// Initialize an empty map to hold the data
-		data := make(map[string]string)
-
-		// Iterate over the childrenResults map
-		for key, value := range childrenResults {
-			// Add each key-value pair to the data map
-			data[key] = value
-		}
-
-		err = parse.Execute(strBuilder, data)
-		elems := config.Message{
-			Role:    message.Role,
-			Content: strBuilder.String(),
-		}
-
-		chatConfig.Messages = append(chatConfig.Messages, elems)
-		chatConfig.RequestURL = t.URL
-		chatConfig.RequestMethod = t.Method
+	// Add each message from the node's params to the llm configuration;
+	// structured values render as JSON in the prompt
+	messages, err := renderMessages(o.params.Messages, utils.ToTemplateData(childrenResults))
+	if err != nil {
+		return nil, err
 	}
+	chatConfig.Messages = messages
 
 	// Create a new GPTChat instance with the llm configuration
 	gptChat := llm.NewGPTChat(key, &config.Config{
@@ -72,17 +70,56 @@ func (o *OpenAICall) Do(
 	})
 
 	// Execute the llm
-	background := context.Background()
-	response, err := gptChat.Execute(background, nil)
+	response, usage, err := gptChat.Complete(ctx)
 	if err != nil {
-		fmt.Printf("Failed to make the OpenAI API call: %s\n", err)
-		return
+		return nil, fmt.Errorf("failed to make the OpenAI API call: %w", err)
 	}
 
-	// Log the response
-	fmt.Printf("OpenAI API response: %s\n", response.(string))
+	output := TextOutput(response)
+	output.Usage = &usage
+	return output, nil
+}
+
+// renderMessages executes the message templates against data.
+func renderMessages(messages []config.Message, data map[string]interface{}) ([]config.Message, error) {
+	rendered := make([]config.Message, 0, len(messages))
+	for _, message := range messages {
+		parse, err := template.New("content").Parse(message.Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the message content: %w", err)
+		}
+		strBuilder := &strings.Builder{}
+		err = parse.Execute(strBuilder, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render the message content: %w", err)
+		}
+		rendered = append(rendered, config.Message{
+			Role:    message.Role,
+			Content: strBuilder.String(),
+		})
+	}
+	return rendered, nil
+}
 
-	// Signal this agent's completion
-	resultCh[agentId] <- response.(string)
-	close(resultCh[agentId])
+// Plan shows the endpoint, the model and the prompts with placeholders in
+// place of the inputs. Prompts that look into an input's fields can't be
+// rendered without the actual values and are shown as written.
+func (o *OpenAICall) Plan(
+	dagConfig *config.DagConfig,
+	agentId string,
+	inputs []string,
+) ([]Detail, error) {
+	details := []Detail{
+		{Name: "url", Value: o.params.Method + " " + o.params.URL},
+		{Name: "model", Value: o.params.Model},
+	}
+	placeholders := inputPlaceholders(inputs)
+	for _, message := range o.params.Messages {
+		content := message.Content
+		if rendered, err := renderMessages([]config.Message{message}, placeholders); err == nil {
+			content = rendered[0].Content
+		}
+		details = append(details, Detail{Name: "prompt (" + message.Role + ")", Value: content})
+	}
+	return details, nil
 }
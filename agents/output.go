@@ -0,0 +1,28 @@
+package agents
+
+import "ai-dag/llm"
+
+// Content types of agent outputs
+const (
+	ContentTypeText = "text/plain"
+	ContentTypeJSON = "application/json"
+)
+
+// Output is what an agent produces. Value must be JSON-compatible: a
+// string, or anything encoding/json can marshal.
+type Output struct {
+	Value       interface{}
+	ContentType string
+	// Usage is set by agents that call an LLM
+	Usage *llm.Usage
+}
+
+// TextOutput wraps a plain text value.
+func TextOutput(text string) *Output {
+	return &Output{Value: text, ContentType: ContentTypeText}
+}
+
+// JSONOutput wraps a structured value.
+func JSONOutput(value interface{}) *Output {
+	return &Output{Value: value, ContentType: ContentTypeJSON}
+}
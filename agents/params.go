@@ -0,0 +1,354 @@
+package agents
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ParamType is the type of a node parameter as written in graph.yaml.
+type ParamType string
+
+const (
+	ParamString ParamType = "string"
+	ParamInt    ParamType = "integer"
+	ParamFloat  ParamType = "number"
+	ParamBool   ParamType = "boolean"
+	ParamList   ParamType = "list"
+	ParamObject ParamType = "object"
+	ParamAny    ParamType = "any"
+)
+
+// Param describes one entry of a node's `params:`.
+type Param struct {
+	Name     string
+	Type     ParamType
+	Required bool
+	// Default is used when the param is not set; nil means no default
+	Default interface{}
+	// Fields describes the entries of object params built from a struct
+	Fields *ParamSchema
+	// Items describes the elements of list params
+	Items *Param
+}
+
+// ParamSchema lists the params an agent type accepts. Agents build theirs
+// from the struct they decode their params into, see SchemaOf.
+type ParamSchema struct {
+	Params []*Param
+}
+
+// ParamError reports a param that does not match its schema. Path is the
+// dotted path of the param within `params:`, e.g. "location.lat".
+type ParamError struct {
+	Path    string
+	Message string
+}
+
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("param %s: %s", e.Path, e.Message)
+}
+
+// SchemaOf derives a schema from a params struct. Each exported field is a
+// param named after its `param` tag, or its `json` tag, or else the field
+// name with a lower-case first letter. The tag may add ",required", and a
+// `default` tag gives the default value as it would be written in YAML:
+//
+//	type weatherParams struct {
+//		Lat   float64 `param:"lat,required"`
+//		Units string  `param:"units" default:"imperial"`
+//	}
+func SchemaOf(params interface{}) (*ParamSchema, error) {
+	t := reflect.TypeOf(params)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("params must be a struct, got %v", t)
+	}
+	return schemaOf(t)
+}
+
+func schemaOf(t reflect.Type) (*ParamSchema, error) {
+	schema := &ParamSchema{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, required, ok := paramName(field)
+		if !ok {
+			continue
+		}
+		param, err := paramOf(field.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", t.Name(), field.Name, err)
+		}
+		param.Name = name
+		param.Required = required
+		if value, ok := field.Tag.Lookup("default"); ok {
+			param.Default, err = parseDefault(param, value)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: default: %w", t.Name(), field.Name, err)
+			}
+		}
+		schema.Params = append(schema.Params, param)
+	}
+	return schema, nil
+}
+
+// paramName returns the param name of a struct field and whether it is
+// required; ok is false for fields that are not params.
+func paramName(field reflect.StructField) (name string, required bool, ok bool) {
+	if !field.IsExported() {
+		return "", false, false
+	}
+	tag, hasTag := field.Tag.Lookup("param")
+	if !hasTag {
+		tag = field.Tag.Get("json")
+	}
+	name, options, _ := strings.Cut(tag, ",")
+	if name == "-" {
+		return "", false, false
+	}
+	if name == "" {
+		r, size := utf8.DecodeRuneInString(field.Name)
+		name = string(unicode.ToLower(r)) + field.Name[size:]
+	}
+	for _, option := range strings.Split(options, ",") {
+		required = required || option == "required"
+	}
+	return name, required, true
+}
+
+func paramOf(t reflect.Type) (*Param, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return &Param{Type: ParamString}, nil
+	case reflect.Bool:
+		return &Param{Type: ParamBool}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Param{Type: ParamInt}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Param{Type: ParamFloat}, nil
+	case reflect.Slice:
+		items, err := paramOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Param{Type: ParamList, Items: items}, nil
+	case reflect.Struct:
+		fields, err := schemaOf(t)
+		if err != nil {
+			return nil, err
+		}
+		return &Param{Type: ParamObject, Fields: fields}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %v", t.Key())
+		}
+		return &Param{Type: ParamObject}, nil
+	case reflect.Interface:
+		return &Param{Type: ParamAny}, nil
+	}
+	return nil, fmt.Errorf("unsupported param type %v", t)
+}
+
+func parseDefault(param *Param, value string) (interface{}, error) {
+	switch param.Type {
+	case ParamString:
+		return value, nil
+	case ParamBool:
+		return strconv.ParseBool(value)
+	case ParamInt:
+		return strconv.Atoi(value)
+	case ParamFloat:
+		return strconv.ParseFloat(value, 64)
+	}
+	return nil, fmt.Errorf("defaults are not supported for %s params", param.Type)
+}
+
+// Apply checks values against the schema and returns them with the
+// defaults of missing params filled in and numbers converted to int or
+// float64. All mismatches are returned, sorted by path.
+func (s *ParamSchema) Apply(values map[string]interface{}) (map[string]interface{}, []*ParamError) {
+	applied, errs := s.apply("", values)
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Path < errs[j].Path })
+	return applied, errs
+}
+
+func (s *ParamSchema) apply(prefix string, values map[string]interface{}) (map[string]interface{}, []*ParamError) {
+	applied := make(map[string]interface{}, len(s.Params))
+	var errs []*ParamError
+	known := make(map[string]bool, len(s.Params))
+	for _, param := range s.Params {
+		known[param.Name] = true
+		path := prefix + param.Name
+		value, ok := values[param.Name]
+		if !ok || value == nil {
+			if param.Required {
+				errs = append(errs, &ParamError{Path: path, Message: "required"})
+			} else if param.Default != nil {
+				applied[param.Name] = param.Default
+			}
+			continue
+		}
+		value, paramErrs := param.apply(path, value)
+		errs = append(errs, paramErrs...)
+		if len(paramErrs) == 0 {
+			applied[param.Name] = value
+		}
+	}
+	for name := range values {
+		if !known[name] {
+			errs = append(errs, &ParamError{Path: prefix + name, Message: "unknown param"})
+		}
+	}
+	return applied, errs
+}
+
+func (p *Param) apply(path string, value interface{}) (interface{}, []*ParamError) {
+	mismatch := []*ParamError{{Path: path, Message: fmt.Sprintf("expected %s, got %s", p.Type, describe(value))}}
+	switch p.Type {
+	case ParamString:
+		if _, ok := value.(string); ok {
+			return value, nil
+		}
+	case ParamBool:
+		if _, ok := value.(bool); ok {
+			return value, nil
+		}
+	case ParamInt:
+		switch v := value.(type) {
+		case int:
+			return v, nil
+		case int64:
+			return int(v), nil
+		case float64:
+			if v == math.Trunc(v) {
+				return int(v), nil
+			}
+		}
+	case ParamFloat:
+		switch v := value.(type) {
+		case int:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		}
+	case ParamList:
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, mismatch
+		}
+		if p.Items == nil {
+			return items, nil
+		}
+		applied := make([]interface{}, len(items))
+		var errs []*ParamError
+		for i, item := range items {
+			var itemErrs []*ParamError
+			applied[i], itemErrs = p.Items.apply(path+"."+strconv.Itoa(i), item)
+			errs = append(errs, itemErrs...)
+		}
+		return applied, errs
+	case ParamObject:
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, mismatch
+		}
+		if p.Fields == nil {
+			return fields, nil
+		}
+		return p.Fields.apply(path+".", fields)
+	case ParamAny:
+		return value, nil
+	}
+	return nil, mismatch
+}
+
+func describe(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case int, int64, float64:
+		return fmt.Sprintf("the number %v", value)
+	case []interface{}:
+		return "a list"
+	case map[string]interface{}:
+		return "an object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// DecodeParams checks a node's params against the schema of target, a
+// pointer to a params struct, and stores them in it, defaults included.
+func DecodeParams(values map[string]interface{}, target interface{}) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("DecodeParams needs a pointer to a struct, got %T", target)
+	}
+	schema, err := SchemaOf(target)
+	if err != nil {
+		return err
+	}
+	applied, paramErrs := schema.Apply(values)
+	if len(paramErrs) > 0 {
+		errs := make([]error, len(paramErrs))
+		for i, paramErr := range paramErrs {
+			errs[i] = paramErr
+		}
+		return errors.Join(errs...)
+	}
+	return setStruct(v.Elem(), applied)
+}
+
+// setStruct stores values that passed Apply into the fields of a struct.
+func setStruct(v reflect.Value, values map[string]interface{}) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, _, ok := paramName(t.Field(i))
+		if !ok {
+			continue
+		}
+		if value, ok := values[name]; ok {
+			if err := setValue(v.Field(i), value); err != nil {
+				return fmt.Errorf("param %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func setValue(v reflect.Value, value interface{}) error {
+	switch v.Kind() {
+	case reflect.Slice:
+		items := value.([]interface{})
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setValue(slice.Index(i), item); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	case reflect.Struct:
+		return setStruct(v, value.(map[string]interface{}))
+	}
+	rv := reflect.ValueOf(value)
+	if !rv.IsValid() {
+		return nil
+	}
+	if !rv.Type().ConvertibleTo(v.Type()) {
+		return fmt.Errorf("cannot store %T in %v", value, v.Type())
+	}
+	v.Set(rv.Convert(v.Type()))
+	return nil
+}
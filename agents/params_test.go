@@ -0,0 +1,151 @@
+package agents
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testLocation struct {
+	Lat float64 `param:"lat,required"`
+	Lon float64 `param:"lon,required"`
+}
+
+type testParams struct {
+	Query    string                 `param:"query,required"`
+	Radius   int                    `param:"radius" default:"500"`
+	Units    string                 `param:"units" default:"metric"`
+	Open     bool                   `param:"open"`
+	Location testLocation           `param:"location"`
+	Tags     []string               `param:"tags"`
+	Extra    map[string]interface{} `param:"extra"`
+	Anything interface{}            `param:"anything"`
+}
+
+func TestParamSchemaApply(t *testing.T) {
+	schema, err := SchemaOf(testParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		values map[string]interface{}
+		want   map[string]interface{}
+		errs   []string
+	}{
+		{
+			name:   "defaults",
+			values: map[string]interface{}{"query": "cafe"},
+			want:   map[string]interface{}{"query": "cafe", "radius": 500, "units": "metric"},
+		},
+		{
+			name:   "null uses the default",
+			values: map[string]interface{}{"query": "cafe", "radius": nil},
+			want:   map[string]interface{}{"query": "cafe", "radius": 500, "units": "metric"},
+		},
+		{
+			name: "numbers converted",
+			values: map[string]interface{}{
+				"query":    "cafe",
+				"radius":   float64(200),
+				"location": map[string]interface{}{"lat": 51, "lon": int64(-1)},
+			},
+			want: map[string]interface{}{
+				"query":    "cafe",
+				"radius":   200,
+				"units":    "metric",
+				"location": map[string]interface{}{"lat": 51.0, "lon": -1.0},
+			},
+		},
+		{
+			name: "lists, objects and any",
+			values: map[string]interface{}{
+				"query":    "cafe",
+				"tags":     []interface{}{"a", "b"},
+				"extra":    map[string]interface{}{"k": 1},
+				"anything": []interface{}{1, "x"},
+			},
+			want: map[string]interface{}{
+				"query":    "cafe",
+				"radius":   500,
+				"units":    "metric",
+				"tags":     []interface{}{"a", "b"},
+				"extra":    map[string]interface{}{"k": 1},
+				"anything": []interface{}{1, "x"},
+			},
+		},
+		{
+			name:   "required",
+			values: map[string]interface{}{},
+			errs:   []string{"param query: required"},
+		},
+		{
+			name:   "fractional integer",
+			values: map[string]interface{}{"query": "cafe", "radius": 1.5},
+			errs:   []string{"param radius: expected integer, got the number 1.5"},
+		},
+		{
+			name: "every mismatch, sorted by path",
+			values: map[string]interface{}{
+				"open":     "yes",
+				"location": map[string]interface{}{"lat": "north", "alt": 1},
+				"tags":     []interface{}{"a", 2},
+				"bogus":    true,
+			},
+			errs: []string{
+				"param bogus: unknown param",
+				"param location.alt: unknown param",
+				"param location.lat: expected number, got a string",
+				"param location.lon: required",
+				"param open: expected boolean, got a string",
+				"param query: required",
+				"param tags.1: expected string, got the number 2",
+			},
+		},
+		{
+			name:   "wrong container",
+			values: map[string]interface{}{"query": "cafe", "tags": "a", "extra": []interface{}{}},
+			errs: []string{
+				"param extra: expected object, got a list",
+				"param tags: expected list, got a string",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, errs := schema.Apply(test.values)
+			var messages []string
+			for _, err := range errs {
+				messages = append(messages, err.Error())
+			}
+			if strings.Join(messages, "\n") != strings.Join(test.errs, "\n") {
+				t.Fatalf("got errors\n%s\nwant\n%s", strings.Join(messages, "\n"), strings.Join(test.errs, "\n"))
+			}
+			if test.errs == nil && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeParams(t *testing.T) {
+	var params testParams
+	err := DecodeParams(map[string]interface{}{
+		"query":    "cafe",
+		"location": map[string]interface{}{"lat": 51.5, "lon": 0},
+		"tags":     []interface{}{"a"},
+	}, &params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := testParams{
+		Query:    "cafe",
+		Radius:   500,
+		Units:    "metric",
+		Location: testLocation{Lat: 51.5},
+		Tags:     []string{"a"},
+	}
+	if !reflect.DeepEqual(params, want) {
+		t.Errorf("got %+v, want %+v", params, want)
+	}
+}
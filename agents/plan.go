@@ -0,0 +1,29 @@
+package agents
+
+import "ai-dag/config"
+
+// Detail is one line of an agent's plan, e.g. {"url", "https://..."}.
+type Detail struct {
+	Name  string
+	Value string
+}
+
+// Planner is implemented by agents that can describe the request they
+// would make without making it, for `ai-dag plan`. inputs names the values
+// the agent would receive; Plan must not touch the network and must mask
+// secrets.
+type Planner interface {
+	Plan(config *config.DagConfig, agentId string, inputs []string) ([]Detail, error)
+}
+
+// maskedSecret is shown in plans in place of a secret.
+const maskedSecret = "****"
+
+// inputPlaceholders stands in for the values an agent would receive.
+func inputPlaceholders(inputs []string) map[string]interface{} {
+	data := make(map[string]interface{}, len(inputs))
+	for _, input := range inputs {
+		data[input] = "<" + input + ">"
+	}
+	return data
+}
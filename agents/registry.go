@@ -0,0 +1,136 @@
+package agents
+
+import (
+	"ai-dag/config"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Agent is implemented by every node type that can run inside a DAG. Do
+// receives the values produced by the node's children keyed by child ID and
+// returns the node's own output; the executor takes care of handing it to
+// parents. Agents must stop their work and return when ctx is done.
+type Agent interface {
+	Do(
+		ctx context.Context,
+		config *config.DagConfig,
+		agentId string,
+		childResults map[string]interface{},
+	) (*Output, error)
+}
+
+// Factory builds an Agent from the configuration of the node it runs for.
+type Factory func(agentConfig config.AgentConfig) (Agent, error)
+
+// Registry maps agent type names, as used by the `type:` field in
+// graph.yaml, to the factories that build them.
+type Registry struct {
+	lock      sync.RWMutex
+	factories map[string]Factory
+	required  map[string][]string
+	params    map[string]*ParamSchema
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		factories: make(map[string]Factory),
+		required:  make(map[string][]string),
+		params:    make(map[string]*ParamSchema),
+	}
+}
+
+// DefaultRegistry holds the agent types shipped with this module; they
+// register themselves from their init functions.
+var DefaultRegistry = NewRegistry()
+
+// Register adds a factory to the DefaultRegistry.
+func Register(agentType string, factory Factory, required ...string) {
+	DefaultRegistry.Register(agentType, factory, required...)
+}
+
+// RegisterParams declares the params of an agent type in the
+// DefaultRegistry.
+func RegisterParams(agentType string, params interface{}) {
+	DefaultRegistry.RegisterParams(agentType, params)
+}
+
+// Register adds a factory under the given type name. required lists the
+// graph.yaml fields, as dotted paths such as "payload.radius", that every
+// node of this type must set. Registering the same name twice is a
+// programming error and panics.
+func (r *Registry) Register(agentType string, factory Factory, required ...string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if agentType == "" {
+		panic("agents: Register with empty type name")
+	}
+	if factory == nil {
+		panic("agents: Register with nil factory for " + agentType)
+	}
+	if _, exists := r.factories[agentType]; exists {
+		panic("agents: Register called twice for " + agentType)
+	}
+	r.factories[agentType] = factory
+	r.required[agentType] = required
+}
+
+// Has reports whether a factory is registered under agentType.
+func (r *Registry) Has(agentType string) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	_, ok := r.factories[agentType]
+	return ok
+}
+
+// RegisterParams declares the `params:` nodes of agentType accept, as the
+// struct their factory decodes them into with DecodeParams. Types without
+// params reject any. An invalid params struct is a programming error and
+// panics.
+func (r *Registry) RegisterParams(agentType string, params interface{}) {
+	schema, err := SchemaOf(params)
+	if err != nil {
+		panic("agents: RegisterParams for " + agentType + ": " + err.Error())
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.params[agentType] = schema
+}
+
+// Params returns the params schema of agentType, or nil if it takes none.
+func (r *Registry) Params(agentType string) *ParamSchema {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.params[agentType]
+}
+
+// Required returns the fields nodes of agentType must set.
+func (r *Registry) Required(agentType string) []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.required[agentType]
+}
+
+// Types returns the registered type names in sorted order.
+func (r *Registry) Types() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	types := make([]string, 0, len(r.factories))
+	for agentType := range r.factories {
+		types = append(types, agentType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// New builds the agent for a node using the factory registered for its type.
+func (r *Registry) New(agentConfig config.AgentConfig) (Agent, error) {
+	r.lock.RLock()
+	factory, ok := r.factories[agentConfig.Type]
+	r.lock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown agent type %q", agentConfig.Type)
+	}
+	return factory(agentConfig)
+}
@@ -0,0 +1,25 @@
+package agents
+
+import (
+	"context"
+	"fmt"
+)
+
+type secretKey struct{}
+
+// WithSecret returns a context carrying the value of a node's `secret:`,
+// which the DAG looks up before running the node's agent.
+func WithSecret(ctx context.Context, value string) context.Context {
+	return context.WithValue(ctx, secretKey{}, value)
+}
+
+// Secret returns the value of the running node's `secret:`. Agents that
+// call an API with a key get it from here rather than from the
+// environment.
+func Secret(ctx context.Context) (string, error) {
+	value, ok := ctx.Value(secretKey{}).(string)
+	if !ok {
+		return "", fmt.Errorf("no secret set, add `secret:` to the node")
+	}
+	return value, nil
+}
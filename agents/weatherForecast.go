@@ -3,47 +3,63 @@ package agents
 import (
 	"ai-dag/config"
 	"ai-dag/utils"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
 )
 
 type WeatherForecast struct {
+	params WeatherForecastParams
 }
 
-func NewWeatherForecast() *WeatherForecast {
-	return &WeatherForecast{}
+// WeatherForecastParams are the `params:` of weatherForecast nodes, sent
+// as query parameters to the One Call API.
+type WeatherForecastParams struct {
+	Lat     float64 `param:"lat,required"`
+	Lon     float64 `param:"lon,required"`
+	Units   string  `param:"units" default:"imperial"`
+	Lang    string  `param:"lang" default:"en"`
+	Exclude string  `param:"exclude"`
+}
+
+func init() {
+	Register("weatherForecast", func(agentConfig config.AgentConfig) (Agent, error) {
+		var params WeatherForecastParams
+		if err := DecodeParams(agentConfig.Params, &params); err != nil {
+			return nil, err
+		}
+		return NewWeatherForecast(params), nil
+	}, "secret")
+	RegisterParams("weatherForecast", WeatherForecastParams{})
+}
+
+func NewWeatherForecast(params WeatherForecastParams) *WeatherForecast {
+	return &WeatherForecast{params: params}
 }
 
 func (owc *WeatherForecast) Do(
+	ctx context.Context,
 	config *config.DagConfig,
 	agentId string,
-	resultCh map[string]chan string,
-	childResults map[string]string,
-) {
+	childResults map[string]interface{},
+) (*Output, error) {
 	var weatherResponse *CurrentWeatherResponse
-	format := "https://api.openweathermap.org/data/3.0/onecall?lat=%f&lon=%f&appid=%s&lang=%s&units=%s"
-	parameters := config.Agents[agentId].QueryParameters
-	appId := os.Getenv("OPEN_WEATHER_API_KEY")
-	if appId == "" {
-		fmt.Println("OPEN_WEATHER_API_KEY not set")
-		return
+	appId, err := Secret(ctx)
+	if err != nil {
+		return nil, err
 	}
-	url := fmt.Sprintf(
-		format,
-		parameters.Lat,
-		parameters.Lon,
-		appId,
-		parameters.Lang,
-		parameters.Units,
-	)
-	resp, err := http.Get(url)
+	url := owc.url(appId)
+	// The API key is in the query string, keep it out of errors
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, utils.RedactURL(err)
+	}
+	resp, err := utils.HTTPClient.Do(req)
 	if err != nil {
-		log.Printf("Error: %v", err)
-		return
+		return nil, fmt.Errorf("weather request failed: %w", utils.RedactURL(err))
 	}
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
@@ -54,16 +70,41 @@ func (owc *WeatherForecast) Do(
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Printf("Error reading response body: %v", err)
-		return
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+	if err := utils.CheckResponse(resp, body); err != nil {
+		return nil, err
 	}
 	if err := json.Unmarshal(body, &weatherResponse); err != nil {
-		log.Printf("Error unmarshalling response body: %v", err)
-		return
+		return nil, fmt.Errorf("error unmarshalling response body: %w", err)
 	}
-	jsonStr := utils.ToPrettyJsonFromObject(weatherResponse)
-	resultCh[agentId] <- jsonStr
-	close(resultCh[agentId])
+	return JSONOutput(weatherResponse), nil
+}
+
+func (owc *WeatherForecast) url(appId string) string {
+	format := "https://api.openweathermap.org/data/3.0/onecall?lat=%f&lon=%f&appid=%s&lang=%s&units=%s"
+	parameters := owc.params
+	url := fmt.Sprintf(
+		format,
+		parameters.Lat,
+		parameters.Lon,
+		appId,
+		parameters.Lang,
+		parameters.Units,
+	)
+	if parameters.Exclude != "" {
+		url += "&exclude=" + parameters.Exclude
+	}
+	return url
+}
+
+// Plan shows the request URL with the API key masked
+func (owc *WeatherForecast) Plan(
+	config *config.DagConfig,
+	agentId string,
+	inputs []string,
+) ([]Detail, error) {
+	return []Detail{{Name: "url", Value: "GET " + owc.url(maskedSecret)}}, nil
 }
 
 type CurrentWeatherRequest struct {
@@ -74,8 +115,8 @@ type CurrentWeatherRequest struct {
 }
 
 type CurrentWeather struct {
-	CurrentWeatherRequest
-	CurrentWeatherResponse
+	Request  CurrentWeatherRequest  `json:"request"`
+	Response CurrentWeatherResponse `json:"response"`
 }
 
 type CurrentWeatherResponse struct {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"gopkg.in/yaml.v3"
 	"os"
+	"time"
 )
 
 // Config represents the top-level configuration structure.
@@ -45,34 +46,104 @@ type Message struct {
 }
 
 type DagConfig struct {
-	Agents map[string]AgentConfig `yaml:"agents"`
+	// Path is the absolute path of the file the graph was loaded from
+	Path string `yaml:"-"`
+	// Timeout is the deadline for the whole run; zero means no deadline.
+	Timeout time.Duration          `yaml:"timeout,omitempty"`
+	Agents  map[string]AgentConfig `yaml:"agents"`
+	// Outputs lists the nodes whose results are returned as the graph's
+	// outputs; when empty, every node nobody depends on is an output.
+	Outputs []string `yaml:"outputs,omitempty"`
+	// MaxConcurrency caps the number of agents running at once; zero means
+	// no limit. Concurrency does the same per agent type.
+	MaxConcurrency int            `yaml:"maxConcurrency,omitempty"`
+	Concurrency    map[string]int `yaml:"concurrency,omitempty"`
+	// Inputs declares the graph's parameters, which node settings refer
+	// to as {{ .inputs.name }}.
+	Inputs map[string]InputConfig `yaml:"inputs,omitempty"`
+	// InputValues holds the value of every input the graph was loaded
+	// with, defaults included.
+	InputValues map[string]interface{} `yaml:"-"`
+	// Secrets lists where the secrets nodes reference are looked up, in
+	// order; when empty, they are read from the environment.
+	Secrets []SecretSource `yaml:"secrets,omitempty"`
+}
+
+// InputConfig declares one of a graph's inputs.
+type InputConfig struct {
+	// Type is string, integer, number, boolean, list, object or any.
+	Type string `yaml:"type"`
+	// Default is used when no value is given; inputs without a default
+	// must be given one.
+	Default     interface{} `yaml:"default,omitempty"`
+	Description string      `yaml:"description,omitempty"`
+}
+
+// SecretSource is one entry of a graph's `secrets:` list.
+type SecretSource struct {
+	// Provider is "env", "dotenv" or "dir".
+	Provider string `yaml:"provider"`
+	// Path is the .env file or the secrets directory, relative to the
+	// graph file.
+	Path string `yaml:"path,omitempty"`
 }
 
 type Location struct {
-	Lat float64 `json:"lat" yaml:"lat"`
-	Lng float64 `json:"lng" yaml:"lng"`
+	Lat float64 `json:"lat" yaml:"lat" param:"lat,required"`
+	Lng float64 `json:"lng" yaml:"lng" param:"lng,required"`
+}
+
+// RetryPolicy controls how often a failing agent is re-executed. Only
+// transient failures are retried: network errors, timeouts and HTTP
+// responses whose status is listed in RetryableStatuses.
+type RetryPolicy struct {
+	// MaxAttempts includes the first execution; zero or one disables retries.
+	MaxAttempts    int           `yaml:"maxAttempts"`
+	InitialBackoff time.Duration `yaml:"initialBackoff"`
+	MaxBackoff     time.Duration `yaml:"maxBackoff"`
+	// Jitter randomizes each backoff by up to this fraction, e.g. 0.2 = ±20%.
+	Jitter float64 `yaml:"jitter"`
+	// RetryableStatuses defaults to 429, 500, 502, 503 and 504.
+	RetryableStatuses []int `yaml:"retryableStatuses,omitempty"`
+}
+
+// MapConfig turns a node into a map node: its agent runs once per element
+// of a list found in one of its children's values.
+type MapConfig struct {
+	// Over is a dotted path to the list, starting with a child ID, e.g.
+	// "nearBySearch.results".
+	Over string `yaml:"over"`
+	// As is the name under which each element is handed to the agent,
+	// "item" by default.
+	As string `yaml:"as,omitempty"`
+	// MaxConcurrency bounds how many elements are processed at once, 4 by
+	// default.
+	MaxConcurrency int `yaml:"maxConcurrency,omitempty"`
+}
+
+// CacheConfig opts a node into output memoization.
+type CacheConfig struct {
+	// TTL is how long a cached output stays valid; zero never expires.
+	TTL time.Duration `yaml:"ttl"`
 }
 
 type AgentConfig struct {
-	ID             string    `yaml:"id"`
-	Children       []string  `yaml:"children"`
-	Plugin         string    `yaml:"agents"`
-	PromptTemplate string    `yaml:"promptTemplate"`
-	URL            string    `yaml:"url,omitempty"`
-	Method         string    `yaml:"method,omitempty"`
-	Model          string    `yaml:"model,omitempty"`
-	Messages       []Message `yaml:"messages,omitempty"`
-	Payload        struct {
-		Key      string   `json:"key" yaml:"key"`
-		Location Location `json:"location" yaml:"location"`
-		Radius   int      `json:"radius" yaml:"radius"`
-		Type     string   `json:"type" yaml:"type"`
-	} `json:"payload" yaml:"payload"`
-	QueryParameters struct {
-		Exclude string  `json:"exclude" yaml:"exclude"`
-		Lang    string  `json:"lang" yaml:"lang"`
-		Lat     float64 `json:"lat" yaml:"lat"`
-		Lon     float64 `json:"lon" yaml:"lon"`
-		Units   string  `json:"units" yaml:"units"`
-	} `json:"queryParameters" yaml:"queryParameters"`
+	ID             string                 `yaml:"id,omitempty"`
+	Children       []string               `yaml:"children,omitempty"`
+	Type           string                 `yaml:"type"`
+	PromptTemplate string                 `yaml:"promptTemplate,omitempty"`
+	Timeout        time.Duration          `yaml:"timeout,omitempty"` // per execution, zero means no limit
+	Retry          *RetryPolicy           `yaml:"retry,omitempty"`
+	When           string                 `yaml:"when,omitempty"`    // template over the children's values, skip unless truthy
+	Default        interface{}            `yaml:"default,omitempty"` // value handed to parents when skipped
+	Map            *MapConfig             `yaml:"map,omitempty"`
+	Cache          *CacheConfig           `yaml:"cache,omitempty"`
+	Graph          string                 `yaml:"graph,omitempty"`   // subgraph file, relative to this graph's file
+	Inputs         map[string]interface{} `yaml:"inputs,omitempty"`  // values of the subgraph's inputs
+	Provide        map[string]string      `yaml:"provide,omitempty"` // subgraph node ID -> path into the children's values
+	Subgraph       *DagConfig             `yaml:"-"`                 // loaded from Graph by the dag package
+	Secret         string                 `yaml:"secret,omitempty"`  // name of the secret handed to the agent, e.g. an API key
+	// Params holds the agent-specific settings, checked against the
+	// schema the agent type registers and decoded by its factory.
+	Params map[string]interface{} `yaml:"params,omitempty"`
 }
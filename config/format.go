@@ -0,0 +1,382 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format is a file format graphs can be written in.
+type Format string
+
+const (
+	FormatYAML Format = "yaml"
+	FormatJSON Format = "json"
+	FormatTOML Format = "toml"
+)
+
+// Formats lists the supported formats.
+var Formats = []Format{FormatYAML, FormatJSON, FormatTOML}
+
+// ParseFormat returns the format with the given name; "yml" is accepted
+// for YAML.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "yaml", "yml":
+		return FormatYAML, nil
+	case "json":
+		return FormatJSON, nil
+	case "toml":
+		return FormatTOML, nil
+	}
+	return "", fmt.Errorf("unknown format %q, expected yaml, json or toml", name)
+}
+
+// FormatOf returns the format a file's extension names, or "" for other
+// extensions.
+func FormatOf(path string) Format {
+	format, err := ParseFormat(strings.TrimPrefix(filepath.Ext(path), "."))
+	if err != nil {
+		return ""
+	}
+	return format
+}
+
+// DetectFormat guesses the format of a document from its content: JSON
+// documents start with "{", TOML documents are the ones the TOML parser
+// accepts and anything else is YAML.
+func DetectFormat(data []byte) Format {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		return FormatJSON
+	}
+	if len(trimmed) > 0 {
+		var document map[string]interface{}
+		if _, err := toml.Decode(string(trimmed), &document); err == nil && len(document) > 0 {
+			return FormatTOML
+		}
+	}
+	return FormatYAML
+}
+
+// ParseDocument parses a graph document into a YAML tree, whatever its
+// format, so that it is interpolated and decoded the same way. JSON
+// documents are converted and keep their line numbers; TOML documents are
+// converted and have none. An empty document gives an empty tree.
+func ParseDocument(data []byte, format Format) (*yaml.Node, error) {
+	var root yaml.Node
+	switch format {
+	case FormatYAML:
+		if err := yaml.Unmarshal(data, &root); err != nil {
+			return nil, err
+		}
+	case FormatJSON:
+		if len(bytes.TrimSpace(data)) == 0 {
+			return &root, nil
+		}
+		content, err := jsonNode(data)
+		if err != nil {
+			return nil, err
+		}
+		root = yaml.Node{Kind: yaml.DocumentNode, Line: content.Line, Column: content.Column, Content: []*yaml.Node{content}}
+	case FormatTOML:
+		var document map[string]interface{}
+		if _, err := toml.Decode(string(data), &document); err != nil {
+			return nil, err
+		}
+		if len(document) == 0 {
+			return &root, nil
+		}
+		content, err := tomlNode(document)
+		if err != nil {
+			return nil, err
+		}
+		root = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{content}}
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+	return &root, nil
+}
+
+// jsonNode builds the YAML tree of a JSON document. The document is read
+// by encoding/json rather than the YAML parser, which rejects some JSON
+// escapes such as \/. Strings are marked double quoted, as the YAML parser
+// would mark them, and every node has the line and column of its value.
+func jsonNode(data []byte) (*yaml.Node, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	r := &jsonReader{decoder: decoder, data: data}
+	node, err := r.value()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		line, _ := r.position()
+		return nil, fmt.Errorf("line %d: unexpected content after the document", line)
+	}
+	return node, nil
+}
+
+// jsonReader reads the values of a JSON document while keeping track of
+// line numbers.
+type jsonReader struct {
+	decoder *json.Decoder
+	data    []byte
+	// offset is where line starts at lineStart were last counted
+	offset    int
+	line      int
+	lineStart int
+}
+
+// position returns the line and column of the next token.
+func (r *jsonReader) position() (int, int) {
+	start := int(r.decoder.InputOffset())
+	for start < len(r.data) && strings.IndexByte(" \t\r\n,:", r.data[start]) >= 0 {
+		start++
+	}
+	for ; r.offset < start; r.offset++ {
+		if r.data[r.offset] == '\n' {
+			r.line++
+			r.lineStart = r.offset + 1
+		}
+	}
+	return r.line + 1, start - r.lineStart + 1
+}
+
+func (r *jsonReader) value() (*yaml.Node, error) {
+	line, column := r.position()
+	token, err := r.decoder.Token()
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %w", line, err)
+	}
+	node := &yaml.Node{Kind: yaml.ScalarNode, Line: line, Column: column}
+	switch t := token.(type) {
+	case json.Delim:
+		node.Kind, node.Tag = yaml.SequenceNode, "!!seq"
+		if t == '{' {
+			node.Kind, node.Tag = yaml.MappingNode, "!!map"
+		}
+		for r.decoder.More() {
+			if node.Kind == yaml.MappingNode {
+				key, err := r.value()
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, key)
+			}
+			child, err := r.value()
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		// The closing delimiter
+		if _, err := r.decoder.Token(); err != nil {
+			line, _ := r.position()
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	case string:
+		node.Tag, node.Value, node.Style = "!!str", t, yaml.DoubleQuotedStyle
+	case json.Number:
+		node.Tag, node.Value = "!!int", t.String()
+		if strings.ContainsAny(node.Value, ".eE") {
+			node.Tag = "!!float"
+		}
+	case bool:
+		node.Tag, node.Value = "!!bool", strconv.FormatBool(t)
+	case nil:
+		node.Tag, node.Value = "!!null", "null"
+	}
+	return node, nil
+}
+
+// tomlNode builds the YAML tree of a decoded TOML value. Each scalar is
+// tagged with its TOML type, so that a float such as 1.0 stays a float
+// instead of being resolved again from its text. Keys are sorted.
+func tomlNode(value interface{}) (*yaml.Node, error) {
+	scalar := func(tag, text string) *yaml.Node {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: text}
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, key := range keys {
+			child, err := tomlNode(v[key])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			node.Content = append(node.Content, scalar("!!str", key), child)
+		}
+		return node, nil
+	case []map[string]interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, table := range v {
+			child, err := tomlNode(table)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		return node, nil
+	case []interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range v {
+			child, err := tomlNode(item)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		return node, nil
+	case string:
+		return scalar("!!str", v), nil
+	case bool:
+		return scalar("!!bool", strconv.FormatBool(v)), nil
+	case int64:
+		return scalar("!!int", strconv.FormatInt(v, 10)), nil
+	case float64:
+		return scalar("!!float", floatText(v)), nil
+	case time.Time:
+		return scalar("!!timestamp", v.Format(time.RFC3339Nano)), nil
+	}
+	return nil, fmt.Errorf("unsupported TOML value %T", value)
+}
+
+// floatText writes a float so that it reads back as a float in YAML and
+// JSON: integral values keep a ".0".
+func floatText(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return ".inf"
+	case math.IsInf(f, -1):
+		return "-.inf"
+	case math.IsNaN(f):
+		return ".nan"
+	}
+	text := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(text, ".e") {
+		text += ".0"
+	}
+	return text
+}
+
+// Export writes a graph in the given format. Loading the result gives the
+// same DagConfig back: settings are written as they were loaded, with
+// variables and input references already replaced, and the defaults of
+// the inputs are set to the values the graph was loaded with.
+func Export(w io.Writer, cfg *DagConfig, format Format) error {
+	exported := *cfg
+	if len(cfg.Inputs) > 0 {
+		exported.Inputs = make(map[string]InputConfig, len(cfg.Inputs))
+		for name, input := range cfg.Inputs {
+			if value, ok := cfg.InputValues[name]; ok {
+				input.Default = value
+			}
+			input.Default = keepFloats(input.Default)
+			exported.Inputs[name] = input
+		}
+	}
+	exported.Agents = make(map[string]AgentConfig, len(cfg.Agents))
+	for agentID, agentConfig := range cfg.Agents {
+		agentConfig.Default = keepFloats(agentConfig.Default)
+		agentConfig.Params, _ = keepFloats(agentConfig.Params).(map[string]interface{})
+		agentConfig.Inputs, _ = keepFloats(agentConfig.Inputs).(map[string]interface{})
+		exported.Agents[agentID] = agentConfig
+	}
+
+	// Go through a YAML tree so that the yaml tags name the fields and
+	// durations are written as strings such as "30s"
+	var tree yaml.Node
+	if err := tree.Encode(&exported); err != nil {
+		return err
+	}
+	if format == FormatYAML {
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(&tree); err != nil {
+			return err
+		}
+		return encoder.Close()
+	}
+
+	var document map[string]interface{}
+	if err := tree.Decode(&document); err != nil {
+		return err
+	}
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(jsonFloats(document))
+	case FormatTOML:
+		return toml.NewEncoder(w).Encode(document)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// exactFloat is a float64 that is written with floatText, since the YAML
+// encoder writes 1.0 as 1, which reads back as an integer.
+type exactFloat float64
+
+func (f exactFloat) MarshalYAML() (interface{}, error) {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: floatText(float64(f))}, nil
+}
+
+// keepFloats returns a copy of a generic value with its floats replaced by
+// exactFloats. nil maps stay nil.
+func keepFloats(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if v == nil {
+			return v
+		}
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = keepFloats(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = keepFloats(item)
+		}
+		return copied
+	case float64:
+		return exactFloat(v)
+	}
+	return value
+}
+
+// jsonFloats replaces the floats of a generic document with json.Numbers
+// written by floatText, since encoding/json writes 1.0 as 1.
+func jsonFloats(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = jsonFloats(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = jsonFloats(item)
+		}
+	case float64:
+		if !math.IsInf(v, 0) && !math.IsNaN(v) {
+			return json.Number(floatText(v))
+		}
+	}
+	return value
+}
@@ -0,0 +1,280 @@
+package config
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want Format
+	}{
+		{"json", `{"agents": {}}`, FormatJSON},
+		{"json after whitespace", "\n  {\"agents\": {}}", FormatJSON},
+		{"toml", "timeout = \"30s\"\n[agents.a]\ntype = \"x\"\n", FormatTOML},
+		{"toml table only", "[agents.a]\ntype = \"x\"\n", FormatTOML},
+		{"yaml", "agents:\n  a:\n    type: x\n", FormatYAML},
+		{"yaml flow mapping is not json", "agents: {a: {type: x}}", FormatYAML},
+		{"empty", "", FormatYAML},
+		{"blank", " \n\t", FormatYAML},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := DetectFormat([]byte(test.data)); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for name, want := range map[string]Format{"yaml": FormatYAML, "YML": FormatYAML, "json": FormatJSON, "toml": FormatTOML} {
+		if got, err := ParseFormat(name); err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %q, %v, want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("ParseFormat(xml) succeeded")
+	}
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	cfg := &DagConfig{
+		Timeout:        2 * time.Minute,
+		MaxConcurrency: 4,
+		Concurrency:    map[string]int{"openAICall": 1},
+		Outputs:        []string{"summary"},
+		Inputs: map[string]InputConfig{
+			"lat":   {Type: "number", Default: 40.7, Description: "Latitude"},
+			"city":  {Type: "string"},
+			"scale": {Type: "number"},
+		},
+		InputValues: map[string]interface{}{"lat": 51.5, "city": "London", "scale": 1.0},
+		Secrets:     []SecretSource{{Provider: "env"}, {Provider: "dotenv", Path: ".env"}},
+		Agents: map[string]AgentConfig{
+			"weather": {
+				Type:    "weatherForecast",
+				Secret:  "openweather_api_key",
+				Timeout: 10 * time.Second,
+				Retry:   &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second, Jitter: 0.2},
+				Params:  map[string]interface{}{"lat": 51.5, "lon": -1.0, "days": 3, "units": "metric", "tags": []interface{}{"a", "b"}},
+			},
+			"summary": {
+				Type:           "openAICall",
+				Children:       []string{"weather"},
+				PromptTemplate: "Weather: {{ .weather }}",
+				When:           "{{ .weather }}",
+			},
+		},
+	}
+	want := *cfg
+	want.Inputs = map[string]InputConfig{
+		"lat":   {Type: "number", Default: 51.5, Description: "Latitude"},
+		"city":  {Type: "string", Default: "London"},
+		"scale": {Type: "number", Default: 1.0},
+	}
+	want.InputValues = nil
+
+	for _, format := range Formats {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Export(&buf, cfg, format); err != nil {
+				t.Fatalf("Export: %v", err)
+			}
+			if got := DetectFormat(buf.Bytes()); got != format {
+				t.Errorf("exported document detected as %s", got)
+			}
+			root, err := ParseDocument(buf.Bytes(), format)
+			if err != nil {
+				t.Fatalf("ParseDocument: %v\n%s", err, buf.String())
+			}
+			var got DagConfig
+			if err := root.Decode(&got); err != nil {
+				t.Fatalf("Decode: %v\n%s", err, buf.String())
+			}
+			if !reflect.DeepEqual(&got, &want) {
+				t.Errorf("round trip changed the graph\ngot  %#v\nwant %#v\n%s", got, want, buf.String())
+			}
+		})
+	}
+}
+
+func TestFormatsAreEquivalent(t *testing.T) {
+	documents := map[Format]string{
+		FormatYAML: `
+timeout: 30s
+inputs:
+  scale:
+    type: number
+    default: 1.0
+  count:
+    default: 2
+agents:
+  weather:
+    type: weatherForecast
+    params:
+      lat: 40.0
+      lon: -74.5
+      days: 3
+      code: "1"
+      metric: true
+      tags: [a, 1, 2.0]
+      location: {lat: 1.0, lng: 2}
+    retry:
+      maxAttempts: 3
+      jitter: 0.5
+`,
+		FormatJSON: `{
+  "timeout": "30s",
+  "inputs": {
+    "scale": {"type": "number", "default": 1.0},
+    "count": {"default": 2}
+  },
+  "agents": {
+    "weather": {
+      "type": "weatherForecast",
+      "params": {
+        "lat": 40.0,
+        "lon": -74.5,
+        "days": 3,
+        "code": "1",
+        "metric": true,
+        "tags": ["a", 1, 2.0],
+        "location": {"lat": 1.0, "lng": 2}
+      },
+      "retry": {"maxAttempts": 3, "jitter": 0.5}
+    }
+  }
+}`,
+		FormatTOML: `
+timeout = "30s"
+
+[inputs.scale]
+type = "number"
+default = 1.0
+
+[inputs.count]
+default = 2
+
+[agents.weather]
+type = "weatherForecast"
+
+[agents.weather.params]
+lat = 40.0
+lon = -74.5
+days = 3
+code = "1"
+metric = true
+tags = ["a", 1, 2.0]
+location = {lat = 1.0, lng = 2}
+
+[agents.weather.retry]
+maxAttempts = 3
+jitter = 0.5
+`,
+	}
+
+	decoded := make(map[Format]*DagConfig, len(documents))
+	for _, format := range Formats {
+		root, err := ParseDocument([]byte(documents[format]), format)
+		if err != nil {
+			t.Fatalf("%s: ParseDocument: %v", format, err)
+		}
+		var cfg DagConfig
+		if err := root.Decode(&cfg); err != nil {
+			t.Fatalf("%s: Decode: %v", format, err)
+		}
+		decoded[format] = &cfg
+	}
+
+	yamlConfig := decoded[FormatYAML]
+	if got, ok := yamlConfig.Inputs["scale"].Default.(float64); !ok || got != 1 {
+		t.Errorf("yaml: default is %#v, want float64(1)", yamlConfig.Inputs["scale"].Default)
+	}
+	for _, format := range []Format{FormatJSON, FormatTOML} {
+		if !reflect.DeepEqual(decoded[format], yamlConfig) {
+			t.Errorf("%s differs from yaml\ngot  %#v\nwant %#v", format, decoded[format], yamlConfig)
+		}
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	document := `{
+  "agents": {
+    "forecast": {
+      "type": "weatherForecast",
+      "params": {
+        "url": "https:\/\/api.open-meteo.com\/v1\/forecast",
+        "city": "S\u00e3o Paulo \ud83c\udf27",
+        "quote": "say \"hi\"\n",
+        "lat": -23.5,
+        "scale": 1e3,
+        "days": 3,
+        "metric": true,
+        "units": null
+      }
+    }
+  }
+}`
+	root, err := ParseDocument([]byte(document), FormatJSON)
+	if err != nil {
+		t.Fatalf("ParseDocument: %v", err)
+	}
+	var cfg DagConfig
+	if err := root.Decode(&cfg); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	want := map[string]interface{}{
+		"url":    "https://api.open-meteo.com/v1/forecast",
+		"city":   "São Paulo 🌧",
+		"quote":  "say \"hi\"\n",
+		"lat":    -23.5,
+		"scale":  1000.0,
+		"days":   3,
+		"metric": true,
+		"units":  nil,
+	}
+	if got := cfg.Agents["forecast"].Params; !reflect.DeepEqual(got, want) {
+		t.Errorf("got params %#v, want %#v", got, want)
+	}
+
+	// Nodes keep the position of their value
+	agents := root.Content[0].Content[1]
+	if key := agents.Content[0]; key.Value != "forecast" || key.Line != 3 || key.Column != 5 {
+		t.Errorf("got key %q at %d:%d, want forecast at 3:5", key.Value, key.Line, key.Column)
+	}
+	params := agents.Content[1].Content[3]
+	if url := params.Content[1]; url.Line != 6 || url.Column != 16 {
+		t.Errorf("got url at %d:%d, want 6:16", url.Line, url.Column)
+	}
+}
+
+func TestParseJSONErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		err      string
+	}{
+		{"invalid", "{\n  \"a\": 1,\n  \"b\" 2\n}", "line 3: "},
+		{"unterminated", "{\n  \"a\": [1, 2\n", "line 3: "},
+		{"trailing content", "{\"a\": 1}\n{\"b\": 2}", "line 2: unexpected content after the document"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseDocument([]byte(test.document), FormatJSON)
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Errorf("got error %v, want %q", err, test.err)
+			}
+		})
+	}
+
+	root, err := ParseDocument([]byte(" \n"), FormatJSON)
+	if err != nil || len(root.Content) != 0 {
+		t.Errorf("got %v, %v for an empty document, want an empty tree", root, err)
+	}
+}
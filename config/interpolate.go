@@ -0,0 +1,113 @@
+package config
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"strings"
+)
+
+// InterpolationError reports a reference in a graph file, such as ${VAR},
+// that can't be replaced.
+type InterpolationError struct {
+	Line    int
+	Message string
+}
+
+func (e *InterpolationError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// Interpolate replaces variable references in the scalar values of a YAML
+// tree, before it is decoded:
+//
+//	${NAME}             the value of NAME, which must be set
+//	${NAME:-default}    the value of NAME, or default if NAME is unset or empty
+//	$$                  a literal $
+//
+// lookup returns the value of a variable, usually os.LookupEnv. Unquoted
+// values are typed after replacement, so `lat: ${LAT:-40.7}` decodes as a
+// number. Every reference that can't be replaced is reported.
+func Interpolate(node *yaml.Node, lookup func(name string) (string, bool)) []*InterpolationError {
+	var errs []*InterpolationError
+	var walk func(node *yaml.Node)
+	walk = func(node *yaml.Node) {
+		switch node.Kind {
+		case yaml.ScalarNode:
+			if !strings.Contains(node.Value, "$") {
+				return
+			}
+			value, err := interpolate(node.Value, lookup)
+			if err != nil {
+				errs = append(errs, &InterpolationError{Line: node.Line, Message: err.Error()})
+				return
+			}
+			node.Value = value
+			if node.Style&(yaml.TaggedStyle|yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+				// Resolve the type again from the new value
+				node.Tag = ""
+			}
+		case yaml.AliasNode:
+			// The anchored node is visited where it is defined
+		default:
+			for _, child := range node.Content {
+				walk(child)
+			}
+		}
+	}
+	walk(node)
+	return errs
+}
+
+func interpolate(s string, lookup func(name string) (string, bool)) (string, error) {
+	var out strings.Builder
+	for {
+		i := strings.IndexByte(s, '$')
+		if i < 0 || i == len(s)-1 {
+			out.WriteString(s)
+			return out.String(), nil
+		}
+		out.WriteString(s[:i])
+		switch s[i+1] {
+		case '$':
+			out.WriteByte('$')
+			s = s[i+2:]
+			continue
+		case '{':
+		default:
+			out.WriteByte('$')
+			s = s[i+1:]
+			continue
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated ${ in %q", s[i:])
+		}
+		reference := s[i+2 : i+end]
+		s = s[i+end+1:]
+
+		name, fallback, hasDefault := strings.Cut(reference, ":-")
+		if !isVariableName(name) {
+			return "", fmt.Errorf("invalid variable name %q in ${%s}", name, reference)
+		}
+		value, ok := lookup(name)
+		if !ok || value == "" {
+			if !hasDefault && !ok {
+				return "", fmt.Errorf("variable %s is not set", name)
+			}
+			value = fallback
+		}
+		out.WriteString(value)
+	}
+}
+
+func isVariableName(name string) bool {
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+		case i > 0 && r >= '0' && r <= '9':
+		default:
+			return false
+		}
+	}
+	return name != ""
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	env := map[string]string{"LAT": "51.5", "CITY": "London", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	tests := []struct {
+		name     string
+		document string
+		want     interface{}
+		err      string
+	}{
+		{"plain value is typed", "v: ${LAT}", 51.5, ""},
+		{"quoted value stays a string", `v: "${LAT}"`, "51.5", ""},
+		{"text", "v: weather in ${CITY}", "weather in London", ""},
+		{"several references", "v: ${CITY}/${LAT}", "London/51.5", ""},
+		{"default when unset", "v: ${LON:--0.1}", -0.1, ""},
+		{"default when empty", "v: ${EMPTY:-none}", "none", ""},
+		{"empty without default", "v: x${EMPTY}y", "xy", ""},
+		{"escaped dollar", "v: $${CITY}", "${CITY}", ""},
+		{"lone dollar", "v: costs 5$ or $ 6", "costs 5$ or $ 6", ""},
+		{"sequence item", "v: [a, '${CITY}']", []interface{}{"a", "London"}, ""},
+		{"unset", "a: 1\nv: ${LON}", nil, "line 2: variable LON is not set"},
+		{"unterminated", "v: ${CITY", nil, `line 1: unterminated ${ in "${CITY"`},
+		{"invalid name", "v: ${1A}", nil, `line 1: invalid variable name "1A" in ${1A}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var root yaml.Node
+			if err := yaml.Unmarshal([]byte(test.document), &root); err != nil {
+				t.Fatal(err)
+			}
+			errs := Interpolate(&root, lookup)
+			if test.err != "" {
+				if len(errs) != 1 || errs[0].Error() != test.err {
+					t.Fatalf("got errors %v, want %q", errs, test.err)
+				}
+				return
+			}
+			if len(errs) > 0 {
+				t.Fatalf("Interpolate: %v", errs)
+			}
+			var got map[string]interface{}
+			if err := root.Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got["v"], test.want) {
+				t.Errorf("got %#v, want %#v", got["v"], test.want)
+			}
+		})
+	}
+}
+
+func TestInterpolateReportsEveryError(t *testing.T) {
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte("a: ${A}\nb: ok\nc: ${C}\n"), &root); err != nil {
+		t.Fatal(err)
+	}
+	errs := Interpolate(&root, func(string) (string, bool) { return "", false })
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	want := "line 1: variable A is not set; line 3: variable C is not set"
+	if got := strings.Join(messages, "; "); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
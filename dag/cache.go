@@ -0,0 +1,114 @@
+package dag
+
+import (
+	"ai-dag/config"
+	"ai-dag/llm"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultCacheDir is where node outputs are memoized unless told otherwise.
+const DefaultCacheDir = ".ai-dag/cache"
+
+// Cache memoizes node outputs on disk. Entries are content addressed by a
+// fingerprint of the node's agent type, resolved configuration and the
+// values of its children, so any change to those misses the cache.
+type Cache struct {
+	Dir string
+}
+
+func NewCache(dir string) *Cache {
+	return &Cache{Dir: dir}
+}
+
+// CacheEntry is the stored form of a node output.
+type CacheEntry struct {
+	Fingerprint string      `json:"fingerprint"`
+	AgentId     string      `json:"agentId"`
+	CreatedAt   time.Time   `json:"createdAt"`
+	Value       interface{} `json:"value"`
+	ContentType string      `json:"contentType"`
+	Usage       *llm.Usage  `json:"usage,omitempty"`
+}
+
+// Get returns the entry stored under fingerprint, unless there is none or
+// it is older than ttl. A zero ttl never expires. An entry that can't be
+// read or is corrupt is missing too, and the error says why.
+func (c *Cache) Get(fingerprint string, ttl time.Duration) (*CacheEntry, bool, error) {
+	data, err := os.ReadFile(c.path(fingerprint))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read cache entry: %w", err)
+	}
+	var entry CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false, fmt.Errorf("ignoring corrupt cache entry %s: %w", fingerprint, err)
+	}
+	if ttl > 0 && time.Since(entry.CreatedAt) > ttl {
+		return nil, false, nil
+	}
+	return &entry, true, nil
+}
+
+// Put stores an entry under its fingerprint.
+func (c *Cache) Put(entry *CacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.path(entry.Fingerprint), data)
+}
+
+func (c *Cache) path(fingerprint string) string {
+	return filepath.Join(c.Dir, fingerprint[:2], fingerprint+".json")
+}
+
+// fingerprint hashes what determines a node's output: its agent type, its
+// configuration and the values of its children. Settings that only affect
+// how the agent is executed, such as retries, timeouts and the cache
+// itself, are left out.
+func fingerprint(agentConfig config.AgentConfig, childrenResults map[string]interface{}) (string, error) {
+	agentConfig.Cache = nil
+	agentConfig.Retry = nil
+	agentConfig.Timeout = 0
+	data, err := json.Marshal(struct {
+		Type     string
+		Config   config.AgentConfig
+		Children map[string]interface{}
+	}{agentConfig.Type, agentConfig, childrenResults})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it into place, so readers never see a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,240 @@
+package dag
+
+import (
+	"ai-dag/agents"
+	"ai-dag/config"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCacheGet(t *testing.T) {
+	cache := NewCache(t.TempDir())
+	fresh := &CacheEntry{Fingerprint: strings.Repeat("a", 64), Value: "fresh", CreatedAt: time.Now()}
+	old := &CacheEntry{Fingerprint: strings.Repeat("b", 64), Value: "old", CreatedAt: time.Now().Add(-2 * time.Hour)}
+	for _, entry := range []*CacheEntry{fresh, old} {
+		if err := cache.Put(entry); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+	corrupt := strings.Repeat("c", 64)
+	if err := writeFileAtomic(cache.path(corrupt), []byte("{")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		fingerprint string
+		ttl         time.Duration
+		want        interface{}
+		err         string
+	}{
+		{"hit", fresh.Fingerprint, time.Hour, "fresh", ""},
+		{"expired", old.Fingerprint, time.Hour, nil, ""},
+		{"within ttl", old.Fingerprint, 3 * time.Hour, "old", ""},
+		{"no ttl never expires", old.Fingerprint, 0, "old", ""},
+		{"missing", strings.Repeat("d", 64), 0, nil, ""},
+		{"corrupt", corrupt, 0, nil, "ignoring corrupt cache entry " + corrupt},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entry, ok, err := cache.Get(test.fingerprint, test.ttl)
+			if test.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+					t.Errorf("got error %v, want %q", err, test.err)
+				}
+			} else if err != nil {
+				t.Errorf("Get: %v", err)
+			}
+			if ok != (test.want != nil) {
+				t.Fatalf("got hit %v, want %v", ok, test.want != nil)
+			}
+			if ok && entry.Value != test.want {
+				t.Errorf("got %v, want %v", entry.Value, test.want)
+			}
+		})
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	base := config.AgentConfig{Type: "openAICall", Params: map[string]interface{}{"model": "gpt-4"}}
+	children := map[string]interface{}{"weather": "sunny"}
+	want, err := fingerprint(base, children)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	same := base
+	same.Timeout = time.Minute
+	same.Retry = &config.RetryPolicy{MaxAttempts: 3}
+	same.Cache = &config.CacheConfig{TTL: time.Hour}
+	if got, _ := fingerprint(same, children); got != want {
+		t.Error("retries, timeouts and the cache setting changed the fingerprint")
+	}
+
+	changedParams := base
+	changedParams.Params = map[string]interface{}{"model": "gpt-4o"}
+	for name, got := range map[string]func() (string, error){
+		"params":   func() (string, error) { return fingerprint(changedParams, children) },
+		"children": func() (string, error) { return fingerprint(base, map[string]interface{}{"weather": "rain"}) },
+	} {
+		if fp, _ := got(); fp == want {
+			t.Errorf("changing the %s kept the fingerprint", name)
+		}
+	}
+}
+
+// warningRecorder records the warnings of a run.
+type warningRecorder struct {
+	NopObserver
+	lock     sync.Mutex
+	warnings []string
+}
+
+func (w *warningRecorder) OnNodeWarning(agentId string, err error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.warnings = append(w.warnings, agentId+": "+err.Error())
+}
+
+func TestExecuteCache(t *testing.T) {
+	cache := NewCache(t.TempDir())
+	runs := 0
+	weather := "sunny"
+	newDAG := func(ttl time.Duration) *DAG {
+		d := newTestDAG(&config.DagConfig{
+			Agents: map[string]config.AgentConfig{
+				"weather": {Type: "weather"},
+				"summary": {Type: "summary", Children: []string{"weather"}, Cache: &config.CacheConfig{TTL: ttl}},
+			},
+		}, map[string]agentFunc{
+			"weather": func(context.Context, map[string]interface{}) (*agents.Output, error) {
+				return agents.TextOutput(weather), nil
+			},
+			"summary": func(_ context.Context, childResults map[string]interface{}) (*agents.Output, error) {
+				runs++
+				return agents.TextOutput("it is " + childResults["weather"].(string)), nil
+			},
+		})
+		d.Cache = cache
+		return d
+	}
+	execute := func(d *DAG) *Result {
+		t.Helper()
+		run, err := d.Execute(context.Background())
+		if err != nil {
+			t.Fatalf("Execute: %v", err)
+		}
+		return run.Nodes["summary"]
+	}
+
+	if result := execute(newDAG(time.Hour)); result.Cached || runs != 1 {
+		t.Fatalf("first run: cached %v after %d runs, want the agent run", result.Cached, runs)
+	}
+	result := execute(newDAG(time.Hour))
+	if !result.Cached || runs != 1 || result.Value != "it is sunny" {
+		t.Errorf("second run: got %v, cached %v after %d runs, want the cached value", result.Value, result.Cached, runs)
+	}
+
+	// A different child value misses the cache
+	weather = "rain"
+	if result := execute(newDAG(time.Hour)); result.Cached || result.Value != "it is rain" {
+		t.Errorf("new child value: got %v, cached %v, want the agent run", result.Value, result.Cached)
+	}
+
+	// An expired entry is replaced
+	time.Sleep(10 * time.Millisecond)
+	runs = 0
+	if result := execute(newDAG(time.Millisecond)); result.Cached || runs != 1 {
+		t.Errorf("expired entry: cached %v after %d runs, want the agent run", result.Cached, runs)
+	}
+	if result := execute(newDAG(time.Hour)); !result.Cached || runs != 1 {
+		t.Errorf("after expiry: cached %v after %d runs, want the new entry", result.Cached, runs)
+	}
+}
+
+func TestExecuteReuse(t *testing.T) {
+	cache := NewCache(t.TempDir())
+	runs := 0
+	newDAG := func() *DAG {
+		d := newTestDAG(&config.DagConfig{
+			Agents: map[string]config.AgentConfig{
+				"weather": {Type: "weather"},
+			},
+		}, map[string]agentFunc{
+			"weather": func(context.Context, map[string]interface{}) (*agents.Output, error) {
+				runs++
+				return agents.TextOutput("sunny"), nil
+			},
+		})
+		d.Cache = cache
+		d.Reuse = map[string]bool{"weather": true}
+		return d
+	}
+
+	// Nodes to reuse are never executed, even without a cache: block
+	run, err := newDAG().Execute(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "no cached or supplied result to reuse") {
+		t.Fatalf("got error %v, want nothing to reuse", err)
+	}
+	if runs != 0 {
+		t.Errorf("weather ran %d times, want never", runs)
+	}
+	if got := run.Nodes["weather"].Status; got != StatusFailed {
+		t.Errorf("got status %s, want failed", got)
+	}
+
+	// Any cached result is reused, however old
+	key, err := fingerprint(config.AgentConfig{Type: "weather"}, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cache.Put(&CacheEntry{Fingerprint: key, Value: "cloudy", CreatedAt: time.Now().Add(-24 * 365 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, err = newDAG().Execute(context.Background())
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if result := run.Nodes["weather"]; !result.Cached || result.Value != "cloudy" || runs != 0 {
+		t.Errorf("got %v, cached %v after %d runs, want the cached value", result.Value, result.Cached, runs)
+	}
+}
+
+func TestExecuteCacheWarnings(t *testing.T) {
+	// A cache directory that is a file can be neither read nor written
+	file := filepath.Join(t.TempDir(), "cache")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	d := newTestDAG(&config.DagConfig{
+		Agents: map[string]config.AgentConfig{
+			"weather": {Type: "weather", Cache: &config.CacheConfig{}},
+		},
+	}, map[string]agentFunc{
+		"weather": func(context.Context, map[string]interface{}) (*agents.Output, error) {
+			return agents.TextOutput("sunny"), nil
+		},
+	})
+	d.Cache = NewCache(file)
+	recorder := &warningRecorder{}
+	d.Observers = []Observer{recorder}
+
+	run, err := d.Execute(context.Background())
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if got := run.Nodes["weather"].Value; got != "sunny" {
+		t.Errorf("got %v, want the node to run despite the cache", got)
+	}
+	if len(recorder.warnings) != 2 ||
+		!strings.HasPrefix(recorder.warnings[0], "weather: failed to read cache entry") ||
+		!strings.HasPrefix(recorder.warnings[1], "weather: failed to cache") {
+		t.Errorf("got warnings %q, want a failed read and a failed write", recorder.warnings)
+	}
+}
@@ -0,0 +1,310 @@
+package dag
+
+import (
+	"ai-dag/llm"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultRunsDir is where run checkpoints are kept unless told otherwise.
+const DefaultRunsDir = ".ai-dag/runs"
+
+// Checkpoint persists the result of every node that succeeds during a run
+// to a run directory, so that a failed run can be resumed without
+// re-executing the nodes that already completed:
+//
+//	<runs dir>/<run id>/run.json          the graph file and start time
+//	<runs dir>/<run id>/nodes/<node>.json one file per completed node
+//	<runs dir>/<run id>/results.json      how every node finished, once the
+//	                                      run is over
+type Checkpoint struct {
+	Dir   string
+	RunId string
+	Graph string
+	// Targets are the nodes the run was limited to, if any
+	Targets []string
+	// Inputs are the values the graph's inputs had
+	Inputs map[string]interface{}
+	// StartedAt is when the run started
+	StartedAt time.Time
+}
+
+type runRecord struct {
+	RunId     string                 `json:"runId"`
+	Graph     string                 `json:"graph"`
+	Targets   []string               `json:"targets,omitempty"`
+	Inputs    map[string]interface{} `json:"inputs,omitempty"`
+	StartedAt time.Time              `json:"startedAt"`
+}
+
+type nodeRecord struct {
+	AgentId string `json:"agentId"`
+	// ConfigFingerprint identifies the node's configuration, so that nodes
+	// edited since the checkpoint was written are executed again.
+	ConfigFingerprint string        `json:"configFingerprint"`
+	Value             interface{}   `json:"value"`
+	ContentType       string        `json:"contentType"`
+	Usage             *llm.Usage    `json:"usage,omitempty"`
+	StartedAt         time.Time     `json:"startedAt"`
+	Duration          time.Duration `json:"duration"`
+	Attempts          int           `json:"attempts"`
+	Cached            bool          `json:"cached,omitempty"`
+}
+
+// NodeSummary records how a node finished, without its value.
+type NodeSummary struct {
+	Status   Status        `json:"status"`
+	Duration time.Duration `json:"duration"`
+	Attempts int           `json:"attempts,omitempty"`
+	Cached   bool          `json:"cached,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// NewCheckpoint starts a new run directory under runsDir for the given
+// graph file, limited to targets if any are given and with the given
+// input values.
+func NewCheckpoint(runsDir string, graph string, targets []string, inputs map[string]interface{}) (*Checkpoint, error) {
+	graph, err := filepath.Abs(graph)
+	if err != nil {
+		return nil, err
+	}
+	runId := newRunId()
+	c := &Checkpoint{
+		Dir:       filepath.Join(runsDir, runId),
+		RunId:     runId,
+		Graph:     graph,
+		Targets:   targets,
+		Inputs:    inputs,
+		StartedAt: time.Now(),
+	}
+	record := runRecord{RunId: c.RunId, Graph: graph, Targets: targets, Inputs: inputs, StartedAt: c.StartedAt}
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(filepath.Join(c.Dir, "run.json"), data); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// OpenCheckpoint opens the run directory of an earlier run.
+func OpenCheckpoint(runsDir string, runId string) (*Checkpoint, error) {
+	if runId == "" || strings.ContainsAny(runId, `/\`) || runId == "." || runId == ".." {
+		return nil, fmt.Errorf("invalid run id %q", runId)
+	}
+	dir := filepath.Join(runsDir, runId)
+	data, err := os.ReadFile(filepath.Join(dir, "run.json"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("no run %q in %s", runId, runsDir)
+		}
+		return nil, err
+	}
+	var record runRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("run %q: %w", runId, err)
+	}
+	return &Checkpoint{
+		Dir:       dir,
+		RunId:     record.RunId,
+		Graph:     record.Graph,
+		Targets:   record.Targets,
+		Inputs:    record.Inputs,
+		StartedAt: record.StartedAt,
+	}, nil
+}
+
+// LatestCheckpoint returns the most recent run of the given graph file
+// under runsDir, or nil if there is none.
+func LatestCheckpoint(runsDir string, graph string) (*Checkpoint, error) {
+	graph, err := filepath.Abs(graph)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(runsDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Run IDs only have a one second resolution, so compare start times
+	var latest *Checkpoint
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		c, err := OpenCheckpoint(runsDir, entry.Name())
+		if err != nil || c.Graph != graph {
+			continue
+		}
+		if latest == nil || c.StartedAt.After(latest.StartedAt) {
+			latest = c
+		}
+	}
+	return latest, nil
+}
+
+// Save records a completed node.
+func (c *Checkpoint) Save(agentConfigFingerprint string, result *Result) error {
+	data, err := json.MarshalIndent(nodeRecord{
+		AgentId:           result.AgentId,
+		ConfigFingerprint: agentConfigFingerprint,
+		Value:             result.Value,
+		ContentType:       result.ContentType,
+		Usage:             result.Usage,
+		StartedAt:         result.StartedAt,
+		Duration:          result.Duration,
+		Attempts:          result.Attempts,
+		Cached:            result.Cached,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.nodePath(result.AgentId), data)
+}
+
+// Restore returns the results saved for the nodes of the DAG that can be
+// reused: nodes whose configuration is unchanged and whose children were
+// all restored as well. It also returns the nodes that were saved but
+// whose configuration changed since, in execution order.
+func (c *Checkpoint) Restore(d *DAG) (map[string]*Result, []string, error) {
+	executionOrder, err := d.topologicalSort()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	restored := make(map[string]*Result)
+	var changed []string
+	for _, agentID := range executionOrder {
+		agentConfig := d.Config.Agents[agentID]
+		allChildren := true
+		for _, childID := range agentConfig.Children {
+			_, ok := restored[childID]
+			allChildren = allChildren && ok
+		}
+		if !allChildren {
+			continue
+		}
+
+		data, err := os.ReadFile(c.nodePath(agentID))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		var record nodeRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, nil, fmt.Errorf("checkpoint of %q: %w", agentID, err)
+		}
+		configFingerprint, err := fingerprint(agentConfig, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		if record.ConfigFingerprint != configFingerprint {
+			changed = append(changed, agentID)
+			continue
+		}
+
+		restored[agentID] = &Result{
+			AgentId:     agentID,
+			Status:      StatusSucceeded,
+			Value:       record.Value,
+			ContentType: record.ContentType,
+			StartedAt:   record.StartedAt,
+			Duration:    record.Duration,
+			Usage:       record.Usage,
+			Attempts:    record.Attempts,
+			Cached:      record.Cached,
+		}
+	}
+	return restored, changed, nil
+}
+
+// Finish records how every node of a run finished, failed nodes included.
+func (c *Checkpoint) Finish(run *RunResult) error {
+	summaries := make(map[string]NodeSummary, len(run.Nodes))
+	for agentID, result := range run.Nodes {
+		summary := NodeSummary{
+			Status:   result.Status,
+			Duration: result.Duration,
+			Attempts: result.Attempts,
+			Cached:   result.Cached,
+		}
+		if result.Err != nil {
+			summary.Error = result.Err.Error()
+		}
+		summaries[agentID] = summary
+	}
+	data, err := json.MarshalIndent(summaries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(c.Dir, "results.json"), data)
+}
+
+// Summaries returns how the nodes of the run finished. For runs that were
+// interrupted before Finish, only the nodes that completed are known.
+func (c *Checkpoint) Summaries() (map[string]NodeSummary, error) {
+	summaries := make(map[string]NodeSummary)
+	data, err := os.ReadFile(filepath.Join(c.Dir, "results.json"))
+	if err == nil {
+		if err := json.Unmarshal(data, &summaries); err != nil {
+			return nil, fmt.Errorf("run %q: %w", c.RunId, err)
+		}
+		return summaries, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(filepath.Join(c.Dir, "nodes"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return summaries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(c.Dir, "nodes", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var record nodeRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, fmt.Errorf("checkpoint %s: %w", entry.Name(), err)
+		}
+		summaries[record.AgentId] = NodeSummary{
+			Status:   StatusSucceeded,
+			Duration: record.Duration,
+			Attempts: record.Attempts,
+			Cached:   record.Cached,
+		}
+	}
+	return summaries, nil
+}
+
+func (c *Checkpoint) nodePath(agentId string) string {
+	return filepath.Join(c.Dir, "nodes", url.PathEscape(agentId)+".json")
+}
+
+// newRunId returns a unique run ID such as 20240301-153012-9f86d0. IDs
+// sort by start time, except for runs started within the same second.
+func newRunId() string {
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		panic(err)
+	}
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
@@ -0,0 +1,171 @@
+package dag
+
+import (
+	"ai-dag/agents"
+	"ai-dag/config"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestLatestCheckpoint(t *testing.T) {
+	runsDir := t.TempDir()
+	graph, err := filepath.Abs("graph.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := time.Date(2024, 3, 1, 15, 30, 12, 0, time.UTC)
+	// Runs started within the same second, whose IDs sort the other way
+	// round, and a later run of another graph
+	runs := []runRecord{
+		{RunId: "20240301-153012-ffffff", Graph: graph, StartedAt: started},
+		{RunId: "20240301-153012-000000", Graph: graph, StartedAt: started.Add(500 * time.Millisecond)},
+		{RunId: "20240301-153013-000000", Graph: "/other.yaml", StartedAt: started.Add(time.Second)},
+	}
+	for _, run := range runs {
+		data, err := json.Marshal(run)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writeFileAtomic(filepath.Join(runsDir, run.RunId, "run.json"), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := LatestCheckpoint(runsDir, "graph.yaml")
+	if err != nil {
+		t.Fatalf("LatestCheckpoint: %v", err)
+	}
+	if c == nil || c.RunId != "20240301-153012-000000" {
+		t.Errorf("got %+v, want run 20240301-153012-000000", c)
+	}
+
+	if c, err := LatestCheckpoint(filepath.Join(runsDir, "missing"), "graph.yaml"); c != nil || err != nil {
+		t.Errorf("got %v, %v for a missing runs directory, want nil, nil", c, err)
+	}
+	if err := os.WriteFile(filepath.Join(runsDir, "stray"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := LatestCheckpoint(runsDir, "unknown.yaml"); c != nil || err != nil {
+		t.Errorf("got %v, %v for a graph without runs, want nil, nil", c, err)
+	}
+}
+
+func TestCheckpointRestore(t *testing.T) {
+	runs := make(map[string]int)
+	failReport := true
+	// run returns an agent that counts its runs under name
+	run := func(name string) agentFunc {
+		return func(context.Context, map[string]interface{}) (*agents.Output, error) {
+			runs[name]++
+			if name == "report" && failReport {
+				return nil, errors.New("boom")
+			}
+			return agents.TextOutput(name), nil
+		}
+	}
+	newDAG := func(agentConfigs map[string]config.AgentConfig) *DAG {
+		return newTestDAG(&config.DagConfig{Agents: agentConfigs}, map[string]agentFunc{
+			"fetch":   run("fetch"),
+			"analyze": run("analyze"),
+			"report":  run("report"),
+		})
+	}
+	agentConfigs := map[string]config.AgentConfig{
+		"fetch":   {Type: "fetch", Params: map[string]interface{}{"coin": "BTC"}},
+		"analyze": {Type: "analyze", Children: []string{"fetch"}, Params: map[string]interface{}{"model": "small"}},
+		"report":  {Type: "report", Children: []string{"analyze"}},
+	}
+
+	checkpoint, err := NewCheckpoint(t.TempDir(), "graph.yaml", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := newDAG(agentConfigs)
+	d.Checkpoint = checkpoint
+	if _, err := d.Execute(context.Background()); err == nil {
+		t.Fatal("Execute succeeded, want report to fail")
+	}
+
+	restore := func(agentConfigs map[string]config.AgentConfig) (*DAG, []string, []string) {
+		t.Helper()
+		d := newDAG(agentConfigs)
+		restored, changed, err := checkpoint.Restore(d)
+		if err != nil {
+			t.Fatalf("Restore: %v", err)
+		}
+		d.Provided = restored
+		ids := make([]string, 0, len(restored))
+		for agentID := range restored {
+			ids = append(ids, agentID)
+		}
+		sort.Strings(ids)
+		return d, ids, changed
+	}
+
+	// Completed nodes are restored; the failed one is not
+	_, restored, changed := restore(agentConfigs)
+	if want := []string{"analyze", "fetch"}; !reflect.DeepEqual(restored, want) || len(changed) != 0 {
+		t.Errorf("got restored %v, changed %v, want %v and none", restored, changed, want)
+	}
+
+	// A node whose configuration changed is run again, and so are the
+	// nodes depending on it
+	edited := make(map[string]config.AgentConfig, len(agentConfigs))
+	for agentID, agentConfig := range agentConfigs {
+		edited[agentID] = agentConfig
+	}
+	analyze := edited["analyze"]
+	analyze.Params = map[string]interface{}{"model": "large"}
+	edited["analyze"] = analyze
+	_, restored, changed = restore(edited)
+	if want := []string{"fetch"}; !reflect.DeepEqual(restored, want) || !reflect.DeepEqual(changed, []string{"analyze"}) {
+		t.Errorf("analyze edited: got restored %v, changed %v, want %v and [analyze]", restored, changed, want)
+	}
+
+	fetch := edited["fetch"]
+	fetch.Params = map[string]interface{}{"coin": "ETH"}
+	edited["fetch"] = fetch
+	edited["analyze"] = agentConfigs["analyze"]
+	_, restored, changed = restore(edited)
+	if len(restored) != 0 || !reflect.DeepEqual(changed, []string{"fetch"}) {
+		t.Errorf("fetch edited: got restored %v, changed %v, want none and [fetch]", restored, changed)
+	}
+
+	// Settings that don't affect the output are not changes
+	retried := make(map[string]config.AgentConfig, len(agentConfigs))
+	for agentID, agentConfig := range agentConfigs {
+		agentConfig.Retry = &config.RetryPolicy{MaxAttempts: 3}
+		agentConfig.Timeout = time.Minute
+		retried[agentID] = agentConfig
+	}
+	_, restored, changed = restore(retried)
+	if len(restored) != 2 || len(changed) != 0 {
+		t.Errorf("retry edited: got restored %v, changed %v, want analyze and fetch restored", restored, changed)
+	}
+
+	// Resuming only runs what was not restored
+	edited["fetch"] = agentConfigs["fetch"]
+	edited["analyze"] = analyze
+	d, _, _ = restore(edited)
+	failReport = false
+	for name := range runs {
+		delete(runs, name)
+	}
+	result, err := d.Execute(context.Background())
+	if err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if want := map[string]int{"analyze": 1, "report": 1}; !reflect.DeepEqual(runs, want) {
+		t.Errorf("resume ran %v, want %v", runs, want)
+	}
+	if got := result.Nodes["fetch"].Value; got != "fetch" {
+		t.Errorf("got fetch %v, want the restored %q", got, "fetch")
+	}
+}
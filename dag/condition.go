@@ -0,0 +1,48 @@
+package dag
+
+import (
+	"ai-dag/config"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// parseCondition compiles a node's `when:` expression. Conditions are Go
+// templates evaluated against the values of the node's children, e.g.
+//
+//	when: "{{ gt (len .fetchCryptoMentions) 0 }}"
+func parseCondition(agentId string, when string) (*template.Template, error) {
+	return template.New(agentId).Option("missingkey=zero").Parse(when)
+}
+
+// evaluateCondition renders the condition and reports whether the output
+// is truthy: anything but "", "false", "0", "no" and "<no value>".
+func evaluateCondition(agentId string, when string, values map[string]interface{}) (bool, error) {
+	tmpl, err := parseCondition(agentId, when)
+	if err != nil {
+		return false, err
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, values); err != nil {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(out.String())) {
+	case "", "false", "0", "no", "<no value>":
+		return false, nil
+	}
+	return true, nil
+}
+
+// checkConditions makes sure every `when:` expression parses.
+func checkConditions(cfg *config.DagConfig) error {
+	for _, agentID := range sortedAgentIDs(cfg) {
+		when := cfg.Agents[agentID].When
+		if when == "" {
+			continue
+		}
+		if _, err := parseCondition(agentID, when); err != nil {
+			return fmt.Errorf("agent %q: invalid when condition: %w", agentID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package dag
+
+import (
+	"ai-dag/agents"
+	"ai-dag/config"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateCondition(t *testing.T) {
+	values := map[string]interface{}{
+		"mentions": []interface{}{"BTC", "ETH"},
+		"forecast": map[string]interface{}{"rain": false, "temp": 21.5},
+	}
+	tests := []struct {
+		when string
+		want bool
+		err  bool
+	}{
+		{"{{ gt (len .mentions) 0 }}", true, false},
+		{"{{ gt (len .mentions) 2 }}", false, false},
+		{"{{ not .forecast.rain }}", true, false},
+		{"{{ .forecast.rain }}", false, false},
+		{"{{ .forecast.temp }}", true, false},
+		{"{{ .missing }}", false, false},
+		{"  No ", false, false},
+		{"0", false, false},
+		{"", false, false},
+		{"yes", true, false},
+		{"{{ len .forecast.temp }}", false, true},
+	}
+	for _, test := range tests {
+		got, err := evaluateCondition("node", test.when, values)
+		if (err != nil) != test.err {
+			t.Errorf("%q: got error %v, want error: %v", test.when, err, test.err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%q: got %v, want %v", test.when, got, test.want)
+		}
+	}
+}
+
+func TestExecuteSkipPropagation(t *testing.T) {
+	// join returns the values of the node's children, sorted by child
+	join := func(_ context.Context, childResults map[string]interface{}) (*agents.Output, error) {
+		var values []string
+		for _, childID := range sortedKeys(childResults) {
+			values = append(values, fmt.Sprintf("%s=%v", childID, childResults[childID]))
+		}
+		return agents.TextOutput(strings.Join(values, ",")), nil
+	}
+	d := newTestDAG(&config.DagConfig{
+		Agents: map[string]config.AgentConfig{
+			"fetch": {Type: "empty"},
+			// skipped without a default: its parents are skipped too
+			"analyze": {Type: "join", Children: []string{"fetch"}, When: "{{ gt (len .fetch) 0 }}"},
+			"report":  {Type: "join", Children: []string{"analyze"}},
+			"digest":  {Type: "join", Children: []string{"report"}},
+			// skipped with a default: its parents run with the default
+			"score":   {Type: "join", Children: []string{"fetch"}, When: "{{ gt (len .fetch) 0 }}", Default: "no mentions"},
+			"summary": {Type: "join", Children: []string{"score"}},
+			// a condition that holds
+			"count": {Type: "join", Children: []string{"fetch"}, When: "{{ eq (len .fetch) 0 }}"},
+			// a condition that can't be evaluated fails the node
+			"broken": {Type: "join", Children: []string{"fetch"}, When: "{{ len .fetch.items }}"},
+		},
+	}, map[string]agentFunc{
+		"empty": func(context.Context, map[string]interface{}) (*agents.Output, error) {
+			return agents.JSONOutput([]interface{}{}), nil
+		},
+		"join": join,
+	})
+
+	run, err := d.Execute(context.Background())
+	if err == nil || !strings.Contains(err.Error(), `agent "broken" failed: failed to evaluate when condition`) {
+		t.Fatalf("got error %v, want broken to fail", err)
+	}
+	want := map[string]Status{
+		"fetch":   StatusSucceeded,
+		"analyze": StatusSkipped,
+		"report":  StatusSkipped,
+		"digest":  StatusSkipped,
+		"score":   StatusSkipped,
+		"summary": StatusSucceeded,
+		"count":   StatusSucceeded,
+		"broken":  StatusFailed,
+	}
+	if got := statuses(run); !reflect.DeepEqual(got, want) {
+		t.Errorf("got statuses %v, want %v", got, want)
+	}
+	for agentID, wantErr := range map[string]string{
+		"analyze": "when condition is false: {{ gt (len .fetch) 0 }}",
+		"report":  "dependency skipped: analyze",
+		"digest":  "dependency skipped: report",
+	} {
+		if got := run.Nodes[agentID].Err; got == nil || got.Error() != wantErr {
+			t.Errorf("%s: got reason %v, want %q", agentID, got, wantErr)
+		}
+	}
+	if got := run.Nodes["score"].Value; got != "no mentions" {
+		t.Errorf("score: got value %v, want the default", got)
+	}
+	if got := run.Nodes["summary"].Value; got != "score=no mentions" {
+		t.Errorf("summary: got %v, want %q", got, "score=no mentions")
+	}
+}
@@ -3,151 +3,768 @@ package dag
 import (
 	"ai-dag/agents"
 	"ai-dag/config"
+	"ai-dag/secrets"
+	"ai-dag/tracing"
 	"context"
+	"errors"
 	"fmt"
-	"gopkg.in/yaml.v3"
+	"io"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
 type DAG struct {
-	Lock   sync.Mutex
-	Config *config.DagConfig
+	Lock     sync.Mutex
+	Config   *config.DagConfig
+	Registry *agents.Registry
+	// Provided holds results supplied by the caller, keyed by node ID.
+	// These nodes are not executed; their parents receive the given result.
+	// Neither are the children that only Provided nodes depend on.
+	Provided map[string]*Result
+	// Cache memoizes the outputs of nodes with a `cache:` block; nil
+	// disables caching.
+	Cache *Cache
+	// Checkpoint, if set, receives every node that succeeds so that the
+	// run can be resumed.
+	Checkpoint *Checkpoint
+	// Reuse holds nodes that must not be executed. Unless they are
+	// Provided, their result comes from the cache, regardless of its TTL.
+	Reuse map[string]bool
+	// Rerun holds nodes that must be executed even if the cache has a
+	// result for them. Their new result is still stored in the cache.
+	Rerun map[string]bool
+	// Observers are notified as the run progresses.
+	Observers []Observer
+	// Secrets provides the values of the nodes' `secret:` references; when
+	// nil, it is built from the graph's `secrets:` list.
+	Secrets secrets.Provider
 }
 
 func NewDAG(config *config.DagConfig) *DAG {
 	return &DAG{
-		Config: config,
-		Lock:   sync.Mutex{},
+		Config:   config,
+		Lock:     sync.Mutex{},
+		Registry: agents.DefaultRegistry,
 	}
 }
 
+// LoadDAGFromYAML loads a graph file. Despite its name, it reads every
+// format LoadDAG does.
+//
+// Deprecated: use LoadDAG.
 func LoadDAGFromYAML(yamlFile string) (*config.DagConfig, error) {
+	return LoadDAG(yamlFile)
+}
+
+// LoadDAG loads a graph file written in YAML, JSON or TOML. The format is
+// given by the file's extension, .yaml, .yml, .json or .toml, and detected
+// from the content for other extensions. Equivalent documents give equal
+// configurations whatever their format.
+func LoadDAG(path string) (*config.DagConfig, error) {
+	return LoadDAGWithInputs(path, nil)
+}
+
+// LoadDAGWithInputs loads a graph file like LoadDAG, giving its `inputs:`
+// the values in inputs instead of their defaults.
+func LoadDAGWithInputs(path string, inputs map[string]interface{}) (*config.DagConfig, error) {
+	return loadDAGFile(path, inputs, nil)
+}
+
+// LoadDAGFromReader reads a graph from r in the given format, detecting it
+// from the content if format is empty. The paths of subgraph files and
+// secrets are resolved against the working directory.
+func LoadDAGFromReader(r io.Reader, format config.Format, inputs map[string]interface{}) (*config.DagConfig, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return loadDAG(data, format, "", inputs, nil)
+}
+
+// loadDAGFile loads a graph file and, recursively, the graph files its
+// subgraph nodes reference. stack holds the absolute paths of the files
+// currently being loaded and is used to detect files that include
+// themselves.
+func loadDAGFile(file string, inputs map[string]interface{}, stack []string) (*config.DagConfig, error) {
+	path, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return loadDAG(data, config.FormatOf(path), path, inputs, stack)
+}
+
+// loadDAG decodes and checks a graph document. path is the absolute path
+// of its file, or empty if it was not read from a file.
+func loadDAG(
+	data []byte,
+	format config.Format,
+	path string,
+	inputs map[string]interface{},
+	stack []string,
+) (*config.DagConfig, error) {
 	var cfg config.DagConfig
-	data, err := os.ReadFile(yamlFile)
+	if format == "" {
+		format = config.DetectFormat(data)
+	}
+	err := decodeDocument(data, format, &cfg, inputs)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Path = path
+	err = checkSecrets(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	err = checkAgentTypes(&cfg, agents.DefaultRegistry)
+	if err != nil {
+		return nil, err
+	}
+	err = checkParams(&cfg, agents.DefaultRegistry)
+	if err != nil {
+		return nil, err
+	}
+	_, err = NewDAG(&cfg).topologicalSort()
+	if err != nil {
+		return nil, err
+	}
+	err = checkOutputs(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	err = checkConcurrency(&cfg, agents.DefaultRegistry.Has)
+	if err != nil {
+		return nil, err
+	}
+	err = checkConditions(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	err = checkMaps(&cfg)
 	if err != nil {
 		return nil, err
 	}
-	err = yaml.Unmarshal(data, &cfg)
+	err = loadSubgraphs(&cfg, append(stack, path))
 	if err != nil {
 		return nil, err
 	}
 	return &cfg, nil
 }
 
-func (d *DAG) Execute() {
-	// Determine execution order
-	executionOrder, err := d.topologicalSort()
+// decodeDocument decodes a graph document after replacing the ${VAR}
+// references in its values with environment variables and the
+// {{ .inputs.name }} references with the values of its inputs.
+func decodeDocument(data []byte, format config.Format, cfg *config.DagConfig, inputs map[string]interface{}) error {
+	root, err := config.ParseDocument(data, format)
 	if err != nil {
-		fmt.Println("Failed to sort agents:", err)
-		return
+		return err
+	}
+	if len(root.Content) == 0 {
+		return nil
+	}
+	if errs := config.Interpolate(root, os.LookupEnv); len(errs) > 0 {
+		return errs[0]
 	}
+	declared, err := declaredInputs(root)
+	if err != nil {
+		return err
+	}
+	values, err := resolveInputs(declared, inputs)
+	if err != nil {
+		return err
+	}
+	if errs := substituteInputs(root.Content[0], declared, values); len(errs) > 0 {
+		return errs[0]
+	}
+	if err := root.Decode(cfg); err != nil {
+		return err
+	}
+	for agentID, agentConfig := range cfg.Agents {
+		// `children: []` and no children at all load the same
+		if len(agentConfig.Children) == 0 && agentConfig.Children != nil {
+			agentConfig.Children = nil
+			cfg.Agents[agentID] = agentConfig
+		}
+	}
+	cfg.InputValues = values
+	return nil
+}
+
+// checkSecrets checks the graph's `secrets:` list.
+func checkSecrets(cfg *config.DagConfig) error {
+	for i, source := range cfg.Secrets {
+		if err := secrets.Check(source); err != nil {
+			return fmt.Errorf("secrets[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// checkAgentTypes makes sure every node names an agent type known to the
+// registry, so a typo fails the load instead of silently skipping the node.
+func checkAgentTypes(cfg *config.DagConfig, registry *agents.Registry) error {
+	for _, agentID := range sortedAgentIDs(cfg) {
+		agentType := cfg.Agents[agentID].Type
+		if agentType == "" {
+			return fmt.Errorf("agent %q: missing type", agentID)
+		}
+		if !registry.Has(agentType) {
+			return fmt.Errorf(
+				"agent %q: unknown type %q (known types: %s)",
+				agentID,
+				agentType,
+				strings.Join(registry.Types(), ", "),
+			)
+		}
+	}
+	return nil
+}
+
+// checkParams checks the params of every node against the schema of its
+// agent type and fills in the defaults of missing ones.
+func checkParams(cfg *config.DagConfig, registry *agents.Registry) error {
+	for _, agentID := range sortedAgentIDs(cfg) {
+		agentConfig := cfg.Agents[agentID]
+		schema := registry.Params(agentConfig.Type)
+		if schema == nil {
+			if len(agentConfig.Params) > 0 {
+				return fmt.Errorf("agent %q: %s nodes take no params", agentID, agentConfig.Type)
+			}
+			continue
+		}
+		params, errs := schema.Apply(agentConfig.Params)
+		if len(errs) > 0 {
+			return fmt.Errorf("agent %q: %w", agentID, errs[0])
+		}
+		agentConfig.Params = params
+		cfg.Agents[agentID] = agentConfig
+	}
+	return nil
+}
 
-	// Initialize completionCh for all agents
-	resultCh := make(map[string]chan string)
-	for agentID := range d.Config.Agents {
-		resultCh[agentID] = make(chan string)
+// loadSecrets builds the secrets provider from the graph's `secrets:` list
+// unless one was set.
+func (d *DAG) loadSecrets() error {
+	if d.Secrets != nil {
+		return nil
+	}
+	provider, err := secrets.New(d.Config.Secrets, filepath.Dir(d.Config.Path))
+	if err != nil {
+		return err
+	}
+	d.Secrets = provider
+	return nil
+}
+
+// Execute runs every agent of the graph and returns the result of each
+// node. If any agent fails, the returned error wraps a NodeError per failed
+// node; nodes depending on a failed node are not run and are reported with
+// StatusDependencyFailed.
+//
+// Cancelling ctx, or reaching the run deadline configured in graph.yaml,
+// stops all in-flight agents and makes Execute return the results collected
+// so far along with the context error.
+func (d *DAG) Execute(ctx context.Context) (*RunResult, error) {
+	// Determine execution order, leaving out the nodes only Provided nodes
+	// depend on
+	sorted, err := d.topologicalSort()
+	if err != nil {
+		return nil, fmt.Errorf("failed to sort agents: %w", err)
+	}
+	needed := d.needed()
+	executionOrder := make([]string, 0, len(sorted))
+	for _, agentID := range sorted {
+		if needed[agentID] {
+			executionOrder = append(executionOrder, agentID)
+		}
+	}
+	if err := d.loadSecrets(); err != nil {
+		return nil, err
+	}
+
+	if d.Config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Config.Timeout)
+		defer cancel()
+	}
+	ctx = context.WithValue(ctx, parentDAGKey{}, d)
+	ctx, span := tracing.Start(ctx, "run "+filepath.Base(d.Config.Path), tracing.KindInternal)
+	span.SetAttribute("dag.graph", d.Config.Path)
+	if d.Checkpoint != nil {
+		span.SetAttribute("dag.run_id", d.Checkpoint.RunId)
+	}
+
+	// Initialize a future for all agents
+	futures := make(map[string]*Future, len(executionOrder))
+	for _, agentID := range executionOrder {
+		futures[agentID] = newFuture()
 	}
+	limiter := newLimiter(d.Config)
+	d.notify(func(o Observer) { o.OnRunStart(d) })
 
 	for _, agentID := range executionOrder {
+		if provided, ok := d.Provided[agentID]; ok {
+			result := *provided
+			result.AgentId = agentID
+			if d.Checkpoint != nil && result.Status == StatusSucceeded {
+				d.saveCheckpoint(d.Config.Agents[agentID], &result)
+			}
+			d.notify(func(o Observer) { o.OnNodeFinish(&result) })
+			futures[agentID].resolve(&result)
+			continue
+		}
+
 		// execute agents in reverse topological order
 		data := AgentData{
-			AgentId:  agentID,
-			ResultCh: resultCh,
+			AgentId: agentID,
+			Futures: futures,
+			limiter: limiter,
 		}
 
-		ctx := context.Background()
 		go d.executeAgent(ctx, data)
 	}
 
-	// Wait for the root agent(s) to complete
-	// Assuming the last agent in executionOrder is one of the roots
-	<-resultCh[executionOrder[len(executionOrder)-1]]
+	// Wait for every sink and output to complete. Every other node that
+	// runs is a descendant of one of them, so once they are all done the
+	// whole run is done.
+	var errs []error
+wait:
+	for _, agentID := range d.roots() {
+		if _, err := futures[agentID].Wait(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("run stopped: %w", err))
+			break wait
+		}
+	}
+
+	// Collect whatever has finished; after a cancelled run some futures may
+	// still be pending
+	nodes := make(map[string]*Result, len(futures))
+	for _, agentID := range executionOrder {
+		result := futures[agentID].Result()
+		if result == nil {
+			continue
+		}
+		nodes[agentID] = result
+		if result.Status == StatusFailed {
+			errs = append(errs, &NodeError{AgentId: agentID, Err: result.Err})
+		}
+	}
+	outputs := make(map[string]*Result)
+	for _, agentID := range d.outputs() {
+		if result, ok := nodes[agentID]; ok {
+			outputs[agentID] = result
+		}
+	}
+	run := &RunResult{Nodes: nodes, Outputs: outputs}
+	err = errors.Join(errs...)
+	span.SetError(err)
+	span.Finish()
+	d.notify(func(o Observer) { o.OnRunFinish(run, err) })
+	return run, err
+}
+
+// sinks returns the nodes no other node depends on, in sorted order.
+func (d *DAG) sinks() []string {
+	hasParent := make(map[string]bool, len(d.Config.Agents))
+	for _, agentConfig := range d.Config.Agents {
+		for _, childID := range agentConfig.Children {
+			hasParent[childID] = true
+		}
+	}
+	sinks := make([]string, 0)
+	for _, agentID := range sortedAgentIDs(d.Config) {
+		if !hasParent[agentID] {
+			sinks = append(sinks, agentID)
+		}
+	}
+	return sinks
+}
+
+// outputs returns the nodes whose results are the graph's outputs: the ones
+// declared under `outputs:` in graph.yaml, or every sink otherwise.
+func (d *DAG) outputs() []string {
+	if len(d.Config.Outputs) > 0 {
+		return d.Config.Outputs
+	}
+	return d.sinks()
+}
+
+// roots returns the sinks followed by the declared outputs that are not
+// sinks: the nodes Execute waits for.
+func (d *DAG) roots() []string {
+	roots := d.sinks()
+	isRoot := make(map[string]bool, len(roots))
+	for _, agentID := range roots {
+		isRoot[agentID] = true
+	}
+	for _, agentID := range d.Config.Outputs {
+		if !isRoot[agentID] {
+			isRoot[agentID] = true
+			roots = append(roots, agentID)
+		}
+	}
+	return roots
+}
+
+// needed returns the nodes a run has to resolve: the roots and every node
+// below them that is reached without going through a Provided node. The
+// children of a Provided node are left out unless another node needs
+// them, since nothing would read their results.
+func (d *DAG) needed() map[string]bool {
+	needed := make(map[string]bool, len(d.Config.Agents))
+	var visit func(agentID string)
+	visit = func(agentID string) {
+		if needed[agentID] {
+			return
+		}
+		needed[agentID] = true
+		if _, ok := d.Provided[agentID]; ok {
+			return
+		}
+		for _, childID := range d.Config.Agents[agentID].Children {
+			visit(childID)
+		}
+	}
+	for _, agentID := range d.roots() {
+		visit(agentID)
+	}
+	return needed
+}
+
+// checkOutputs makes sure every declared output names a defined node.
+func checkOutputs(cfg *config.DagConfig) error {
+	for _, agentID := range cfg.Outputs {
+		if _, ok := cfg.Agents[agentID]; !ok {
+			return fmt.Errorf("output %q is not a defined agent", agentID)
+		}
+	}
+	return nil
 }
 
 type AgentData struct {
-	AgentId  string
-	ResultCh map[string]chan string
+	AgentId string
+	// Futures holds the future of every agent of the run
+	Futures map[string]*Future
+	limiter *limiter
 }
 
 func (d *DAG) executeAgent(ctx context.Context, data AgentData) {
 	// Assuming Agents is a map, and you need to access it safely
 	d.Lock.Lock()
-	children := d.Config.Agents[data.AgentId].Children
+	agentConfig := d.Config.Agents[data.AgentId]
 	d.Lock.Unlock()
 
 	// Now wait for child agents without holding the lock
 
-	resultCh := data.ResultCh
-	childrenResults := make(map[string]string, len(children))
-	for _, childID := range children {
-		childrenResults[childID] = <-resultCh[childID]
+	futures := data.Futures
+	childrenResults := make(map[string]interface{}, len(agentConfig.Children))
+	var failedChildren, skippedChildren []string
+	for _, childID := range agentConfig.Children {
+		<-futures[childID].Done()
+		childResult := futures[childID].Result()
+		switch {
+		case childResult.Status == StatusSucceeded:
+			childrenResults[childID] = childResult.Value
+		case childResult.Status == StatusSkipped && childResult.Value != nil:
+			// a skipped child with a default value counts as available
+			childrenResults[childID] = childResult.Value
+		case childResult.Status == StatusSkipped:
+			skippedChildren = append(skippedChildren, childID)
+		default:
+			failedChildren = append(failedChildren, childID)
+		}
 	}
 
 	agentId := data.AgentId
-	switch agentId {
-	case "fetchCryptoMentions":
-		fetchCrypto := agents.NewFetchCryptoMentions()
-		fetchCrypto.Do(d.Config, agentId, resultCh, childrenResults)
-	case "analyzeCryptoSentiment":
-		analyzeSentiment := agents.NewAnalyzeCryptoSentiment()
-		analyzeSentiment.Do(d.Config, agentId, resultCh, childrenResults)
-	case "nearBySearch":
-		agentConfig := d.Config.Agents[agentId]
-		request := agents.NewNearBySearchRequest(
-			agentConfig.Payload.Location,
-			agentConfig.Payload.Radius,
-			agentConfig.Payload.Type,
-			agentConfig.Payload.Key,
-		)
-		nearBySearch := agents.NewNearBySearch(request)
-		nearBySearch.Do(
-			d.Config,
-			agentId,
-			resultCh,
-			childrenResults,
-		)
-	case "weatherForecast":
-		weatherForecast := agents.NewWeatherForecast()
-		weatherForecast.Do(d.Config, agentId, resultCh, childrenResults)
-	case "openAICall":
-		openAICall := agents.NewOpenAICall()
-		openAICall.Do(d.Config, agentId, resultCh, childrenResults)
+	ctx, span := tracing.Start(ctx, "node "+agentId, tracing.KindInternal)
+	span.SetAttribute("dag.agent_id", agentId)
+	span.SetAttribute("dag.agent_type", agentConfig.Type)
+	for _, childID := range agentConfig.Children {
+		span.AddLink(futures[childID].Result().span)
+	}
+
+	result := Result{AgentId: agentId, span: span}
+	run := false
+	switch {
+	case len(failedChildren) > 0:
+		result.Status = StatusDependencyFailed
+		result.Err = fmt.Errorf("dependency failed: %s", strings.Join(failedChildren, ", "))
+	case len(skippedChildren) > 0:
+		result.skip(agentConfig, fmt.Errorf("dependency skipped: %s", strings.Join(skippedChildren, ", ")))
+	case agentConfig.When != "":
+		ok, err := evaluateCondition(agentId, agentConfig.When, childrenResults)
+		if err != nil {
+			result.Status = StatusFailed
+			result.Err = fmt.Errorf("failed to evaluate when condition: %w", err)
+		} else if !ok {
+			result.skip(agentConfig, fmt.Errorf("when condition is false: %s", agentConfig.When))
+		} else {
+			run = true
+		}
+	default:
+		run = true
+	}
+
+	if run {
+		d.runNode(ctx, data.limiter, agentConfig, agentId, childrenResults, &result)
+		if result.Status == StatusSucceeded && d.Checkpoint != nil {
+			d.saveCheckpoint(agentConfig, &result)
+		}
+	}
+
+	span.SetAttribute("dag.status", string(result.Status))
+	span.SetAttribute("dag.attempts", result.Attempts)
+	span.SetAttribute("dag.cached", result.Cached)
+	if result.Status == StatusSucceeded || result.Status == StatusSkipped {
+		span.SetError(nil)
+	} else {
+		span.SetError(result.Err)
+	}
+	span.Finish()
+
+	// Signal this agent's completion, whatever its outcome, so that parents
+	// never block on a failed child
+	d.notify(func(o Observer) { o.OnNodeFinish(&result) })
+	futures[agentId].resolve(&result)
+}
+
+func (d *DAG) saveCheckpoint(agentConfig config.AgentConfig, result *Result) {
+	configFingerprint, err := fingerprint(agentConfig, nil)
+	if err == nil {
+		err = d.Checkpoint.Save(configFingerprint, result)
+	}
+	if err != nil {
+		d.warn(result.AgentId, fmt.Errorf("failed to checkpoint: %w", err))
 	}
 }
 
+// runNode executes a node whose children are all available and records the
+// outcome in result. Nodes with a `cache:` block are served from, and
+// stored into, the DAG's cache; nodes to rerun are only stored into it.
+func (d *DAG) runNode(
+	ctx context.Context,
+	limiter *limiter,
+	agentConfig config.AgentConfig,
+	agentId string,
+	childrenResults map[string]interface{},
+	result *Result,
+) {
+	result.StartedAt = time.Now()
+	d.notify(func(o Observer) { o.OnNodeStart(agentId) })
+
+	// Nodes to reuse take any cached result, however old, and are never
+	// executed; nodes to rerun are always executed
+	reuse := d.Reuse[agentId]
+	rerun := d.Rerun[agentId]
+	var key string
+	if d.Cache != nil && (agentConfig.Cache != nil || reuse) {
+		var ttl time.Duration
+		if !reuse {
+			ttl = agentConfig.Cache.TTL
+		}
+		var err error
+		key, err = fingerprint(agentConfig, childrenResults)
+		if err != nil {
+			d.warn(agentId, fmt.Errorf("not caching: %w", err))
+		} else if !rerun {
+			entry, ok, err := d.Cache.Get(key, ttl)
+			if err != nil {
+				d.warn(agentId, err)
+			}
+			if ok {
+				result.Status = StatusSucceeded
+				result.Value = entry.Value
+				result.ContentType = entry.ContentType
+				result.Usage = entry.Usage
+				result.Cached = true
+				result.Duration = time.Since(result.StartedAt)
+				return
+			}
+		}
+	}
+	if reuse {
+		result.Status = StatusFailed
+		result.Err = fmt.Errorf("no cached or supplied result to reuse")
+		return
+	}
+
+	var output *agents.Output
+	var attempts int
+	var err error
+	if agentConfig.Map != nil {
+		output, attempts, err = d.runMap(ctx, limiter, agentConfig, agentId, childrenResults)
+	} else {
+		output, attempts, err = d.runWithRetry(ctx, limiter, agentConfig, agentId, childrenResults)
+	}
+	result.Duration = time.Since(result.StartedAt)
+	result.Attempts = attempts
+	if err == nil {
+		err = result.setOutput(output)
+	}
+	if err != nil {
+		result.Status = StatusFailed
+		result.Err = err
+		return
+	}
+	result.Status = StatusSucceeded
+
+	if key != "" {
+		err = d.Cache.Put(&CacheEntry{
+			Fingerprint: key,
+			AgentId:     agentId,
+			CreatedAt:   time.Now(),
+			Value:       result.Value,
+			ContentType: result.ContentType,
+			Usage:       result.Usage,
+		})
+		if err != nil {
+			d.warn(agentId, fmt.Errorf("failed to cache: %w", err))
+		}
+	}
+}
+
+// warn tells the observers about a problem with a node that doesn't fail
+// it.
+func (d *DAG) warn(agentId string, err error) {
+	d.notify(func(o Observer) { o.OnNodeWarning(agentId, err) })
+}
+
+// runAgent builds the agent for a node and runs it under the node's
+// timeout, turning a panic inside the agent into an error.
+func (d *DAG) runAgent(
+	ctx context.Context,
+	agentConfig config.AgentConfig,
+	agentId string,
+	childrenResults map[string]interface{},
+) (output *agents.Output, err error) {
+	// Don't start new work once the run has been cancelled
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	agent, err := d.Registry.New(agentConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create agent: %w", err)
+	}
+
+	nodeCtx := ctx
+	if agentConfig.Secret != "" {
+		secret, err := secrets.Get(d.Secrets, agentConfig.Secret)
+		if err != nil {
+			return nil, err
+		}
+		nodeCtx = agents.WithSecret(nodeCtx, secret)
+	}
+	if agentConfig.Timeout > 0 {
+		var cancel context.CancelFunc
+		nodeCtx, cancel = context.WithTimeout(nodeCtx, agentConfig.Timeout)
+		defer cancel()
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("agent panicked: %v", r)
+		}
+	}()
+	output, err = agent.Do(nodeCtx, d.Config, agentId, childrenResults)
+	if err != nil && ctx.Err() == nil && errors.Is(nodeCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s: %w", agentConfig.Timeout, err)
+	}
+	return output, err
+}
+
+// node colors used by topologicalSort's depth-first search
+const (
+	white = iota // not visited yet
+	grey         // on the current DFS path
+	black        // fully explored
+)
+
+// topologicalSort orders agents so that every child comes before its
+// parents. It fails if a child references an agent that is not defined or
+// if the graph contains a cycle, in which case the error names the full
+// cycle, e.g. "a -> b -> c -> a".
 func (d *DAG) topologicalSort() ([]string, error) {
-	visited := make(map[string]bool)
-	result := make([]string, 0)
+	color := make(map[string]int, len(d.Config.Agents))
+	result := make([]string, 0, len(d.Config.Agents))
+	// path holds the nodes on the current DFS path, used to report cycles
+	path := make([]string, 0)
 
 	var visit func(string) error
 	visit = func(nodeID string) error {
-		if visited[nodeID] { // Skip already visited nodes
+		switch color[nodeID] {
+		case black:
 			return nil
+		case grey:
+			return &CycleError{Path: cyclePath(path, nodeID)}
 		}
-		visited[nodeID] = true // Mark node as visited
+		color[nodeID] = grey
+		path = append(path, nodeID)
 
 		// Visit all children
 		for _, childID := range d.Config.Agents[nodeID].Children {
+			if _, ok := d.Config.Agents[childID]; !ok {
+				return fmt.Errorf("agent %q references undefined child %q", nodeID, childID)
+			}
 			if err := visit(childID); err != nil {
-				return err // Handle error as needed
+				return err
 			}
 		}
 
 		// Add this node to the result list (post-order)
+		path = path[:len(path)-1]
+		color[nodeID] = black
 		result = append(result, nodeID)
 		return nil
 	}
 
-	// Perform DFS from each node
-	for nodeID := range d.Config.Agents {
-		if !visited[nodeID] {
-			if err := visit(nodeID); err != nil {
-				return nil, err // Handle error as needed
-			}
+	// Perform DFS from each node, in a stable order so that errors and
+	// execution order do not depend on map iteration
+	for _, nodeID := range sortedAgentIDs(d.Config) {
+		if err := visit(nodeID); err != nil {
+			return nil, err
 		}
 	}
 
 	// No need to reverse the result; it's already in topological order
 	return result, nil
 }
+
+// CycleError is returned when the agents form a cycle. Path starts and ends
+// with the same agent.
+type CycleError struct {
+	Path []string
+}
+
+func (e *CycleError) Error() string {
+	return "cycle detected: " + strings.Join(e.Path, " -> ")
+}
+
+// cyclePath cuts the DFS path at the first occurrence of nodeID and closes
+// the loop by appending nodeID again.
+func cyclePath(path []string, nodeID string) []string {
+	for i, id := range path {
+		if id == nodeID {
+			cycle := make([]string, 0, len(path)-i+1)
+			cycle = append(cycle, path[i:]...)
+			return append(cycle, nodeID)
+		}
+	}
+	return []string{nodeID, nodeID}
+}
+
+func sortedAgentIDs(cfg *config.DagConfig) []string {
+	ids := make([]string, 0, len(cfg.Agents))
+	for agentID := range cfg.Agents {
+		ids = append(ids, agentID)
+	}
+	sort.Strings(ids)
+	return ids
+}
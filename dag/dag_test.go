@@ -0,0 +1,351 @@
+package dag
+
+import (
+	"ai-dag/agents"
+	"ai-dag/config"
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// secretMap is a secrets.Provider backed by a map.
+type secretMap map[string]string
+
+func (m secretMap) Lookup(name string) (string, bool, error) {
+	value, ok := m[name]
+	return value, ok, nil
+}
+
+// agentFunc adapts a function of the children values to the agents.Agent
+// interface.
+type agentFunc func(ctx context.Context, childResults map[string]interface{}) (*agents.Output, error)
+
+func (f agentFunc) Do(ctx context.Context, _ *config.DagConfig, _ string, childResults map[string]interface{}) (*agents.Output, error) {
+	return f(ctx, childResults)
+}
+
+// newTestDAG returns a DAG for cfg whose agent types are the given
+// functions.
+func newTestDAG(cfg *config.DagConfig, types map[string]agentFunc) *DAG {
+	registry := agents.NewRegistry()
+	for agentType, fn := range types {
+		fn := fn
+		registry.Register(agentType, func(config.AgentConfig) (agents.Agent, error) {
+			return fn, nil
+		})
+	}
+	d := NewDAG(cfg)
+	d.Registry = registry
+	return d
+}
+
+// statuses returns the status of every node of a run.
+func statuses(run *RunResult) map[string]Status {
+	got := make(map[string]Status, len(run.Nodes))
+	for agentID, result := range run.Nodes {
+		got[agentID] = result.Status
+	}
+	return got
+}
+
+func TestExecuteSecretWithTimeout(t *testing.T) {
+	registry := agents.NewRegistry()
+	registry.Register("probe", func(config.AgentConfig) (agents.Agent, error) {
+		return agentFunc(func(ctx context.Context, _ map[string]interface{}) (*agents.Output, error) {
+			secret, err := agents.Secret(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := ctx.Deadline(); !ok {
+				return nil, errors.New("no deadline")
+			}
+			return agents.TextOutput(secret), nil
+		}), nil
+	})
+
+	d := NewDAG(&config.DagConfig{
+		Agents: map[string]config.AgentConfig{
+			"probe": {Type: "probe", Secret: "api_key", Timeout: time.Minute},
+		},
+	})
+	d.Registry = registry
+	d.Secrets = secretMap{"api_key": "s3cret"}
+
+	run, err := d.Execute(context.Background())
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if got := run.Nodes["probe"].Value; got != "s3cret" {
+		t.Errorf("agent got secret %v, want %q", got, "s3cret")
+	}
+}
+
+func TestExecuteDependencyFailed(t *testing.T) {
+	d := newTestDAG(&config.DagConfig{
+		Agents: map[string]config.AgentConfig{
+			"fetch":   {Type: "fail"},
+			"analyze": {Type: "ok", Children: []string{"fetch"}},
+			"report":  {Type: "ok", Children: []string{"analyze", "other"}},
+			"other":   {Type: "ok"},
+			"sibling": {Type: "ok"},
+		},
+	}, map[string]agentFunc{
+		"ok": func(context.Context, map[string]interface{}) (*agents.Output, error) {
+			return agents.TextOutput("done"), nil
+		},
+		"fail": func(context.Context, map[string]interface{}) (*agents.Output, error) {
+			return nil, errors.New("boom")
+		},
+	})
+
+	run, err := d.Execute(context.Background())
+	var nodeErr *NodeError
+	if !errors.As(err, &nodeErr) || nodeErr.AgentId != "fetch" || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("got error %v, want a NodeError for fetch", err)
+	}
+	if strings.Contains(err.Error(), "analyze") || strings.Contains(err.Error(), "report") {
+		t.Errorf("error %q reports nodes that never ran", err)
+	}
+	want := map[string]Status{
+		"fetch":   StatusFailed,
+		"analyze": StatusDependencyFailed,
+		"report":  StatusDependencyFailed,
+		"other":   StatusSucceeded,
+		"sibling": StatusSucceeded,
+	}
+	if got := statuses(run); !reflect.DeepEqual(got, want) {
+		t.Errorf("got statuses %v, want %v", got, want)
+	}
+	for agentID, wantErr := range map[string]string{
+		"analyze": "dependency failed: fetch",
+		"report":  "dependency failed: analyze",
+	} {
+		result := run.Nodes[agentID]
+		if result.Err == nil || result.Err.Error() != wantErr {
+			t.Errorf("%s: got error %v, want %q", agentID, result.Err, wantErr)
+		}
+		if result.Attempts != 0 || !result.StartedAt.IsZero() {
+			t.Errorf("%s ran %d times, want it never run", agentID, result.Attempts)
+		}
+	}
+}
+
+func TestExecuteDiamond(t *testing.T) {
+	var lock sync.Mutex
+	runs := make(map[string]int)
+	// Each node records that it ran and returns the values of its
+	// children, sorted, after its own name
+	record := func(name string) agentFunc {
+		return func(_ context.Context, childResults map[string]interface{}) (*agents.Output, error) {
+			lock.Lock()
+			runs[name]++
+			lock.Unlock()
+			values := []string{name}
+			for _, childID := range sortedKeys(childResults) {
+				values = append(values, childResults[childID].(string))
+			}
+			return agents.TextOutput(strings.Join(values, " ")), nil
+		}
+	}
+	d := newTestDAG(&config.DagConfig{
+		Agents: map[string]config.AgentConfig{
+			"weather": {Type: "weather"},
+			"summary": {Type: "summary", Children: []string{"weather"}},
+			"score":   {Type: "score", Children: []string{"weather"}},
+			"report":  {Type: "report", Children: []string{"summary", "score", "weather"}},
+		},
+	}, map[string]agentFunc{
+		"weather": record("sunny"),
+		"summary": record("summary of"),
+		"score":   record("score of"),
+		"report":  record("report:"),
+	})
+
+	run, err := d.Execute(context.Background())
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	want := "report: score of sunny summary of sunny sunny"
+	if got := run.Nodes["report"].Value; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	for name, count := range runs {
+		if count != 1 {
+			t.Errorf("%s ran %d times, want once", name, count)
+		}
+	}
+	if len(runs) != 4 {
+		t.Errorf("got %d nodes run, want 4", len(runs))
+	}
+}
+
+func TestTopologicalSort(t *testing.T) {
+	tests := []struct {
+		name   string
+		agents map[string][]string
+		want   []string
+		err    string
+	}{
+		{
+			name:   "chain",
+			agents: map[string][]string{"a": {"b"}, "b": {"c"}, "c": nil},
+			want:   []string{"c", "b", "a"},
+		},
+		{
+			name:   "diamond",
+			agents: map[string][]string{"a": {"b", "c"}, "b": {"d"}, "c": {"d"}, "d": nil},
+			want:   []string{"d", "b", "c", "a"},
+		},
+		{
+			name:   "undefined child",
+			agents: map[string][]string{"a": {"missing"}},
+			err:    `agent "a" references undefined child "missing"`,
+		},
+		{
+			name:   "self loop",
+			agents: map[string][]string{"a": {"a"}},
+			err:    "cycle detected: a -> a",
+		},
+		{
+			name:   "cycle",
+			agents: map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"a"}},
+			err:    "cycle detected: a -> b -> c -> a",
+		},
+		{
+			name:   "cycle below an acyclic prefix",
+			agents: map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"d"}, "d": {"b"}},
+			err:    "cycle detected: b -> c -> d -> b",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.DagConfig{Agents: make(map[string]config.AgentConfig)}
+			for id, children := range test.agents {
+				cfg.Agents[id] = config.AgentConfig{Children: children}
+			}
+			got, err := NewDAG(cfg).topologicalSort()
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("topologicalSort: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCycleErrorIsTyped(t *testing.T) {
+	cfg := &config.DagConfig{Agents: map[string]config.AgentConfig{
+		"a": {Children: []string{"b"}},
+		"b": {Children: []string{"a"}},
+	}}
+	_, err := NewDAG(cfg).topologicalSort()
+	var cycleErr *CycleError
+	if !errors.As(err, &cycleErr) {
+		t.Fatalf("got %v, want a *CycleError", err)
+	}
+	if got := strings.Join(cycleErr.Path, ","); got != "a,b,a" {
+		t.Errorf("got path %s, want a,b,a", got)
+	}
+}
+
+func TestCyclePath(t *testing.T) {
+	tests := []struct {
+		path   []string
+		nodeID string
+		want   []string
+	}{
+		{[]string{"a", "b", "c"}, "a", []string{"a", "b", "c", "a"}},
+		{[]string{"a", "b", "c"}, "b", []string{"b", "c", "b"}},
+		{[]string{"a", "b", "c"}, "c", []string{"c", "c"}},
+		{[]string{"a"}, "z", []string{"z", "z"}},
+		{nil, "z", []string{"z", "z"}},
+	}
+	for _, test := range tests {
+		if got := cyclePath(test.path, test.nodeID); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("cyclePath(%v, %q) = %v, want %v", test.path, test.nodeID, got, test.want)
+		}
+	}
+}
+
+func TestExecuteSkipsChildrenOfProvidedNodes(t *testing.T) {
+	var lock sync.Mutex
+	ran := make(map[string]bool)
+	registry := agents.NewRegistry()
+	registry.Register("record", func(agentConfig config.AgentConfig) (agents.Agent, error) {
+		return agentFunc(func(context.Context, map[string]interface{}) (*agents.Output, error) {
+			lock.Lock()
+			defer lock.Unlock()
+			ran[agentConfig.ID] = true
+			return agents.TextOutput(agentConfig.ID), nil
+		}), nil
+	})
+
+	tests := []struct {
+		name    string
+		agents  map[string][]string
+		outputs []string
+		want    []string
+	}{
+		{
+			name:   "children of a provided node",
+			agents: map[string][]string{"top": {"provided"}, "provided": {"child"}, "child": {"grandchild"}, "grandchild": nil},
+			want:   []string{"top"},
+		},
+		{
+			name:   "child also needed elsewhere",
+			agents: map[string][]string{"top": {"provided", "other"}, "provided": {"shared", "only"}, "other": {"shared"}, "shared": nil, "only": nil},
+			want:   []string{"other", "shared", "top"},
+		},
+		{
+			name:    "declared output below a provided node",
+			agents:  map[string][]string{"top": {"provided"}, "provided": {"child"}, "child": nil},
+			outputs: []string{"top", "child"},
+			want:    []string{"child", "top"},
+		},
+		{
+			name:   "provided sink",
+			agents: map[string][]string{"provided": {"child"}, "child": nil},
+			want:   nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.DagConfig{Agents: make(map[string]config.AgentConfig), Outputs: test.outputs}
+			for id, children := range test.agents {
+				cfg.Agents[id] = config.AgentConfig{ID: id, Type: "record", Children: children}
+			}
+			d := NewDAG(cfg)
+			d.Registry = registry
+			d.Provided = map[string]*Result{"provided": {Status: StatusSucceeded, Value: "given"}}
+			ran = make(map[string]bool)
+
+			run, err := d.Execute(context.Background())
+			if err != nil {
+				t.Fatalf("Execute: %v", err)
+			}
+			var got []string
+			for id := range ran {
+				got = append(got, id)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ran %v, want %v", got, test.want)
+			}
+			if len(run.Nodes) != len(test.want)+1 {
+				t.Errorf("got %d results, want %d", len(run.Nodes), len(test.want)+1)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package dag
+
+import (
+	"ai-dag/config"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Diagram formats supported by WriteDiagram.
+const (
+	FormatDOT     = "dot"
+	FormatMermaid = "mermaid"
+)
+
+// statusColors are the fill colors of nodes in a diagram with run results.
+var statusColors = map[Status]string{
+	StatusSucceeded:        "#c8e6c9",
+	StatusFailed:           "#ffcdd2",
+	StatusDependencyFailed: "#ffe0b2",
+	StatusSkipped:          "#e0e0e0",
+}
+
+// WriteDiagram renders the graph as a Graphviz DOT or Mermaid flowchart,
+// with edges going from children to the nodes that consume their values.
+// Each node is labelled with its agent type and key settings. If summaries
+// is not nil, the status and duration of each node in that run are added
+// to its label and set its color.
+func WriteDiagram(w io.Writer, cfg *config.DagConfig, format string, summaries map[string]NodeSummary) error {
+	d := NewDAG(cfg)
+	order, err := d.topologicalSort()
+	if err != nil {
+		return err
+	}
+	switch format {
+	case FormatDOT:
+		return writeDOT(w, cfg, order, summaries)
+	case FormatMermaid:
+		return writeMermaid(w, cfg, order, summaries)
+	}
+	return fmt.Errorf("unknown diagram format %q, expected %s or %s", format, FormatDOT, FormatMermaid)
+}
+
+func writeDOT(w io.Writer, cfg *config.DagConfig, order []string, summaries map[string]NodeSummary) error {
+	var b strings.Builder
+	b.WriteString("digraph dag {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box, style=\"rounded,filled\", fillcolor=\"#ffffff\", fontname=\"Helvetica\"];\n")
+	for _, agentID := range order {
+		lines, status := diagramLabel(agentID, cfg.Agents[agentID], summaries)
+		fmt.Fprintf(&b, "  %s [label=%s", dotQuote(agentID), dotQuote(strings.Join(lines, "\n")))
+		if color, ok := statusColors[status]; ok {
+			fmt.Fprintf(&b, ", fillcolor=%s", dotQuote(color))
+		}
+		b.WriteString("];\n")
+	}
+	for _, agentID := range order {
+		for _, childID := range cfg.Agents[agentID].Children {
+			fmt.Fprintf(&b, "  %s -> %s;\n", dotQuote(childID), dotQuote(agentID))
+		}
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeMermaid(w io.Writer, cfg *config.DagConfig, order []string, summaries map[string]NodeSummary) error {
+	// Mermaid IDs can't hold arbitrary characters, so nodes are numbered
+	// and the agent ID is part of the label
+	ids := make(map[string]string, len(order))
+	for i, agentID := range order {
+		ids[agentID] = fmt.Sprintf("n%d", i)
+	}
+
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	used := make(map[Status]bool)
+	for _, agentID := range order {
+		lines, status := diagramLabel(agentID, cfg.Agents[agentID], summaries)
+		fmt.Fprintf(&b, "  %s[\"%s\"]\n", ids[agentID], mermaidEscape(strings.Join(lines, "\n")))
+		if _, ok := statusColors[status]; ok {
+			fmt.Fprintf(&b, "  class %s %s\n", ids[agentID], mermaidClass(status))
+			used[status] = true
+		}
+	}
+	for _, agentID := range order {
+		for _, childID := range cfg.Agents[agentID].Children {
+			fmt.Fprintf(&b, "  %s --> %s\n", ids[childID], ids[agentID])
+		}
+	}
+	for _, status := range []Status{StatusSucceeded, StatusFailed, StatusDependencyFailed, StatusSkipped} {
+		if used[status] {
+			fmt.Fprintf(&b, "  classDef %s fill:%s\n", mermaidClass(status), statusColors[status])
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// diagramLabel returns the lines of a node's label and its status in the
+// run, if any.
+func diagramLabel(agentID string, agentConfig config.AgentConfig, summaries map[string]NodeSummary) ([]string, Status) {
+	lines := []string{fmt.Sprintf("%s (%s)", agentID, agentConfig.Type)}
+	if model, ok := agentConfig.Params["model"].(string); ok && model != "" {
+		lines = append(lines, "model: "+model)
+	}
+	if agentConfig.Graph != "" {
+		lines = append(lines, "graph: "+agentConfig.Graph)
+	}
+	if agentConfig.Map != nil {
+		lines = append(lines, "map over: "+agentConfig.Map.Over)
+	}
+	if agentConfig.When != "" {
+		lines = append(lines, "when: "+agentConfig.When)
+	}
+	if agentConfig.Timeout > 0 {
+		lines = append(lines, "timeout: "+agentConfig.Timeout.String())
+	}
+	if agentConfig.Retry != nil && agentConfig.Retry.MaxAttempts > 1 {
+		lines = append(lines, fmt.Sprintf("retry: %d attempts", agentConfig.Retry.MaxAttempts))
+	}
+	if agentConfig.Cache != nil {
+		lines = append(lines, "cache: ttl "+agentConfig.Cache.TTL.String())
+	}
+
+	if summaries == nil {
+		return lines, ""
+	}
+	summary, ok := summaries[agentID]
+	if !ok {
+		return append(lines, "not run"), ""
+	}
+	status := string(summary.Status)
+	if summary.Status == StatusSucceeded || summary.Status == StatusFailed {
+		status += " in " + summary.Duration.Round(time.Millisecond).String()
+	}
+	if summary.Cached {
+		status += " (cached)"
+	}
+	return append(lines, status), summary.Status
+}
+
+// dotQuote quotes a DOT ID or label; newlines become centered line breaks.
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + strings.ReplaceAll(s, "\n", `\n`) + `"`
+}
+
+// mermaidEscape makes text safe inside a quoted Mermaid label.
+func mermaidEscape(s string) string {
+	s = strings.ReplaceAll(s, "&", "#amp;")
+	s = strings.ReplaceAll(s, `"`, "#quot;")
+	s = strings.ReplaceAll(s, "<", "#lt;")
+	s = strings.ReplaceAll(s, ">", "#gt;")
+	return strings.ReplaceAll(s, "\n", "<br/>")
+}
+
+func mermaidClass(status Status) string {
+	return strings.ReplaceAll(string(status), " ", "_")
+}
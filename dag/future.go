@@ -0,0 +1,47 @@
+package dag
+
+import "context"
+
+// Future is the eventual result of a node. It is resolved exactly once by
+// the goroutine running the node, after which any number of dependents can
+// read the same result.
+type Future struct {
+	done   chan struct{}
+	result *Result
+}
+
+func newFuture() *Future {
+	return &Future{done: make(chan struct{})}
+}
+
+// resolve stores the result and wakes up every waiter. It must be called
+// only once.
+func (f *Future) resolve(result *Result) {
+	f.result = result
+	close(f.done)
+}
+
+// Done returns a channel that is closed once the result is available.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Result returns the result, or nil if the node has not finished yet.
+func (f *Future) Result() *Result {
+	select {
+	case <-f.done:
+		return f.result
+	default:
+		return nil
+	}
+}
+
+// Wait blocks until the result is available or ctx is done.
+func (f *Future) Wait(ctx context.Context) (*Result, error) {
+	select {
+	case <-f.done:
+		return f.result, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,47 @@
+package dag
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestFuture(t *testing.T) {
+	f := newFuture()
+	if got := f.Result(); got != nil {
+		t.Fatalf("got result %v before resolve, want nil", got)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := f.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v waiting with a cancelled context, want context.Canceled", err)
+	}
+
+	// Every waiter gets the same result
+	var wg sync.WaitGroup
+	results := make([]*Result, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = f.Wait(context.Background())
+		}(i)
+	}
+	want := &Result{AgentId: "weather", Status: StatusSucceeded, Value: "sunny"}
+	f.resolve(want)
+	wg.Wait()
+	for i, got := range results {
+		if got != want {
+			t.Errorf("waiter %d got %v, want %v", i, got, want)
+		}
+	}
+	if got := f.Result(); got != want {
+		t.Errorf("got result %v after resolve, want %v", got, want)
+	}
+	select {
+	case <-f.Done():
+	default:
+		t.Error("Done is not closed after resolve")
+	}
+}
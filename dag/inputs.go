@@ -0,0 +1,226 @@
+package dag
+
+import (
+	"ai-dag/agents"
+	"ai-dag/config"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"regexp"
+	"strings"
+)
+
+// inputRefPattern matches a template action that reads a graph input,
+// e.g. {{ .inputs.lat }}.
+var inputRefPattern = regexp.MustCompile(`\{\{-?\s*\.inputs\.([A-Za-z_][A-Za-z0-9_]*)\s*-?\}\}`)
+
+// inputUsePattern matches any action using .inputs, to report the ones
+// inputRefPattern does not replace.
+var inputUsePattern = regexp.MustCompile(`\{\{[^}]*\.inputs\b`)
+
+var inputTypes = []agents.ParamType{
+	agents.ParamString,
+	agents.ParamInt,
+	agents.ParamFloat,
+	agents.ParamBool,
+	agents.ParamList,
+	agents.ParamObject,
+	agents.ParamAny,
+}
+
+// declaredInputs decodes the `inputs:` of a graph file's YAML tree alone,
+// since the rest can't be decoded before its references are replaced.
+func declaredInputs(root *yaml.Node) (map[string]config.InputConfig, error) {
+	var declared struct {
+		Inputs map[string]config.InputConfig `yaml:"inputs"`
+	}
+	if err := root.Decode(&declared); err != nil {
+		return nil, err
+	}
+	return declared.Inputs, nil
+}
+
+// inputSchema checks the declarations of a graph's inputs and returns the
+// schema their values are checked against. Inputs without a type accept
+// any value.
+func inputSchema(inputs map[string]config.InputConfig) (*agents.ParamSchema, error) {
+	schema := &agents.ParamSchema{}
+	for _, name := range sortedKeys(inputs) {
+		input := inputs[name]
+		param := &agents.Param{Name: name, Type: agents.ParamType(input.Type), Required: input.Default == nil}
+		if param.Type == "" {
+			param.Type = agents.ParamAny
+		}
+		known := false
+		for _, inputType := range inputTypes {
+			known = known || param.Type == inputType
+		}
+		if !known {
+			return nil, fmt.Errorf("input %s: unknown type %q (known types: %s)", name, input.Type, joinTypes(inputTypes))
+		}
+		if input.Default != nil {
+			single := &agents.ParamSchema{Params: []*agents.Param{param}}
+			applied, errs := single.Apply(map[string]interface{}{name: input.Default})
+			if len(errs) > 0 {
+				return nil, fmt.Errorf("input %s: default: %s", name, errs[0].Message)
+			}
+			param.Default = applied[name]
+		}
+		schema.Params = append(schema.Params, param)
+	}
+	return schema, nil
+}
+
+func joinTypes(types []agents.ParamType) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = string(t)
+	}
+	return strings.Join(names, ", ")
+}
+
+// resolveInputs checks the values given for a graph's inputs and fills in
+// the defaults of the others. Values given as strings, e.g. with `run
+// -set`, are parsed as YAML for inputs that are not strings, so "51.5"
+// becomes a number.
+func resolveInputs(inputs map[string]config.InputConfig, values map[string]interface{}) (map[string]interface{}, error) {
+	for _, name := range sortedKeys(values) {
+		if _, ok := inputs[name]; !ok {
+			return nil, unknownInput(name, inputs)
+		}
+	}
+	if len(inputs) == 0 {
+		return nil, nil
+	}
+	schema, err := inputSchema(inputs)
+	if err != nil {
+		return nil, err
+	}
+	converted := make(map[string]interface{}, len(values))
+	for name, value := range values {
+		if s, ok := value.(string); ok && inputs[name].Type != string(agents.ParamString) {
+			var parsed interface{}
+			if err := yaml.Unmarshal([]byte(s), &parsed); err == nil {
+				value = parsed
+			}
+		}
+		converted[name] = value
+	}
+	applied, errs := schema.Apply(converted)
+	if len(errs) > 0 {
+		if _, given := converted[errs[0].Path]; !given {
+			return nil, fmt.Errorf("input %s has no default and no value was given", errs[0].Path)
+		}
+		return nil, fmt.Errorf("input %s: %s", errs[0].Path, errs[0].Message)
+	}
+	return applied, nil
+}
+
+func unknownInput(name string, inputs map[string]config.InputConfig) error {
+	if len(inputs) == 0 {
+		return fmt.Errorf("unknown input %q, the graph declares no inputs", name)
+	}
+	return fmt.Errorf("unknown input %q (graph inputs: %s)", name, strings.Join(sortedKeys(inputs), ", "))
+}
+
+// zeroInput stands in for an input without a default when a graph is
+// validated without values.
+func zeroInput(inputType agents.ParamType) interface{} {
+	switch inputType {
+	case agents.ParamString:
+		return ""
+	case agents.ParamInt:
+		return 0
+	case agents.ParamFloat:
+		return 0.0
+	case agents.ParamBool:
+		return false
+	case agents.ParamList:
+		return []interface{}{}
+	case agents.ParamObject:
+		return map[string]interface{}{}
+	}
+	return nil
+}
+
+// substituteInputs replaces the {{ .inputs.name }} references in the
+// values of a graph file's YAML tree, except under `inputs:` itself. A
+// value made of a single reference takes the input's type, so that
+// `lat: "{{ .inputs.lat }}"` is a number; elsewhere the input is written
+// as text, with lists and objects as JSON. Other uses of .inputs, such as
+// {{ if .inputs.debug }}, are reported since they can't be replaced.
+func substituteInputs(document *yaml.Node, inputs map[string]config.InputConfig, values map[string]interface{}) []*config.InterpolationError {
+	if document == nil || document.Kind != yaml.MappingNode {
+		return nil
+	}
+	var errs []*config.InterpolationError
+	for i := 0; i+1 < len(document.Content); i += 2 {
+		if document.Content[i].Value != "inputs" {
+			errs = append(errs, substituteNode(document.Content[i+1], inputs, values)...)
+		}
+	}
+	return errs
+}
+
+func substituteNode(node *yaml.Node, inputs map[string]config.InputConfig, values map[string]interface{}) []*config.InterpolationError {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return substituteScalar(node, inputs, values)
+	case yaml.AliasNode:
+		// The anchored node is visited where it is defined
+		return nil
+	}
+	var errs []*config.InterpolationError
+	for _, child := range node.Content {
+		errs = append(errs, substituteNode(child, inputs, values)...)
+	}
+	return errs
+}
+
+func substituteScalar(node *yaml.Node, inputs map[string]config.InputConfig, values map[string]interface{}) []*config.InterpolationError {
+	if !strings.Contains(node.Value, ".inputs") {
+		return nil
+	}
+	fail := func(err error) []*config.InterpolationError {
+		return []*config.InterpolationError{{Line: node.Line, Message: err.Error()}}
+	}
+
+	if match := inputRefPattern.FindStringSubmatch(node.Value); match != nil && match[0] == node.Value {
+		if _, ok := inputs[match[1]]; !ok {
+			return fail(unknownInput(match[1], inputs))
+		}
+		var replacement yaml.Node
+		if err := replacement.Encode(values[match[1]]); err != nil {
+			return fail(fmt.Errorf("input %s: %w", match[1], err))
+		}
+		replacement.Line, replacement.Column = node.Line, node.Column
+		*node = replacement
+		return nil
+	}
+
+	var errs []*config.InterpolationError
+	replaced := inputRefPattern.ReplaceAllStringFunc(node.Value, func(ref string) string {
+		name := inputRefPattern.FindStringSubmatch(ref)[1]
+		if _, ok := inputs[name]; !ok {
+			errs = append(errs, fail(unknownInput(name, inputs))...)
+			return ""
+		}
+		return inputText(values[name])
+	})
+	if len(errs) == 0 && inputUsePattern.MatchString(replaced) {
+		errs = fail(fmt.Errorf("inputs can only be used as {{ .inputs.name }}"))
+	}
+	node.Value = replaced
+	return errs
+}
+
+func inputText(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,198 @@
+package dag
+
+import (
+	"ai-dag/config"
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveInputs(t *testing.T) {
+	inputs := map[string]config.InputConfig{
+		"lat":   {Type: "number", Default: 40.7},
+		"count": {Type: "integer"},
+		"name":  {Type: "string", Default: "x"},
+		"tags":  {Type: "list", Default: []interface{}{}},
+	}
+	tests := []struct {
+		name   string
+		inputs map[string]config.InputConfig
+		values map[string]interface{}
+		want   map[string]interface{}
+		err    string
+	}{
+		{
+			name:   "defaults",
+			inputs: inputs,
+			values: map[string]interface{}{"count": 3},
+			want:   map[string]interface{}{"lat": 40.7, "count": 3, "name": "x", "tags": []interface{}{}},
+		},
+		{
+			name:   "strings parsed for typed inputs",
+			inputs: inputs,
+			values: map[string]interface{}{"lat": "51.5", "count": "2", "name": "12", "tags": "[a, b]"},
+			want:   map[string]interface{}{"lat": 51.5, "count": 2, "name": "12", "tags": []interface{}{"a", "b"}},
+		},
+		{
+			name:   "untyped inputs take any value",
+			inputs: map[string]config.InputConfig{"debug": {}},
+			values: map[string]interface{}{"debug": "true"},
+			want:   map[string]interface{}{"debug": true},
+		},
+		{
+			name:   "integer accepted for number",
+			inputs: inputs,
+			values: map[string]interface{}{"lat": 51, "count": 1},
+			want:   map[string]interface{}{"lat": 51.0, "count": 1, "name": "x", "tags": []interface{}{}},
+		},
+		{
+			name:   "missing value",
+			inputs: inputs,
+			values: nil,
+			err:    "input count has no default and no value was given",
+		},
+		{
+			name:   "wrong type",
+			inputs: inputs,
+			values: map[string]interface{}{"count": "many"},
+			err:    "input count: expected integer, got a string",
+		},
+		{
+			name:   "unknown input",
+			inputs: inputs,
+			values: map[string]interface{}{"count": 1, "lon": 1},
+			err:    `unknown input "lon" (graph inputs: count, lat, name, tags)`,
+		},
+		{
+			name:   "no inputs declared",
+			values: map[string]interface{}{"lat": 1},
+			err:    `unknown input "lat", the graph declares no inputs`,
+		},
+		{
+			name: "no inputs, no values",
+		},
+		{
+			name:   "unknown type",
+			inputs: map[string]config.InputConfig{"lat": {Type: "float"}},
+			err:    `input lat: unknown type "float"`,
+		},
+		{
+			name:   "default of the wrong type",
+			inputs: map[string]config.InputConfig{"lat": {Type: "number", Default: "north"}},
+			err:    "input lat: default: expected number, got a string",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := resolveInputs(test.inputs, test.values)
+			if test.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveInputs: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSubstituteInputs(t *testing.T) {
+	inputs := map[string]config.InputConfig{
+		"lat":  {Type: "number"},
+		"city": {Type: "string"},
+		"tags": {Type: "list"},
+	}
+	values := map[string]interface{}{
+		"lat":  51.5,
+		"city": "London",
+		"tags": []interface{}{"a", "b"},
+	}
+	tests := []struct {
+		name     string
+		document string
+		want     map[string]interface{}
+		err      string
+	}{
+		{
+			name:     "whole value keeps its type",
+			document: `lat: "{{ .inputs.lat }}"`,
+			want:     map[string]interface{}{"lat": 51.5},
+		},
+		{
+			name:     "list",
+			document: `tags: "{{ .inputs.tags }}"`,
+			want:     map[string]interface{}{"tags": []interface{}{"a", "b"}},
+		},
+		{
+			name:     "text",
+			document: `prompt: "Weather in {{ .inputs.city }} at {{ .inputs.lat }}"`,
+			want:     map[string]interface{}{"prompt": "Weather in London at 51.5"},
+		},
+		{
+			name:     "list in text is JSON",
+			document: `prompt: "tags {{ .inputs.tags }}"`,
+			want:     map[string]interface{}{"prompt": `tags ["a","b"]`},
+		},
+		{
+			name:     "trim markers",
+			document: `lat: "{{- .inputs.lat -}}"`,
+			want:     map[string]interface{}{"lat": 51.5},
+		},
+		{
+			name:     "declarations left alone",
+			document: "inputs:\n  lat:\n    description: \"{{ .inputs.lat }}\"\n",
+			want:     map[string]interface{}{"inputs": map[string]interface{}{"lat": map[string]interface{}{"description": "{{ .inputs.lat }}"}}},
+		},
+		{
+			name:     "other templates left alone",
+			document: `prompt: "{{ .weather }}"`,
+			want:     map[string]interface{}{"prompt": "{{ .weather }}"},
+		},
+		{
+			name:     "unknown input",
+			document: "a: 1\nlon: \"{{ .inputs.lon }}\"",
+			err:      `line 2: unknown input "lon"`,
+		},
+		{
+			name:     "unknown input in text",
+			document: `prompt: "at {{ .inputs.lon }}"`,
+			err:      `line 1: unknown input "lon"`,
+		},
+		{
+			name:     "unsupported use",
+			document: `prompt: "{{ if .inputs.city }}yes{{ end }}"`,
+			err:      "line 1: inputs can only be used as {{ .inputs.name }}",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var root yaml.Node
+			if err := yaml.Unmarshal([]byte(test.document), &root); err != nil {
+				t.Fatal(err)
+			}
+			errs := substituteInputs(root.Content[0], inputs, values)
+			if test.err != "" {
+				if len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), test.err) {
+					t.Fatalf("got errors %v, want %q", errs, test.err)
+				}
+				return
+			}
+			if len(errs) > 0 {
+				t.Fatalf("substituteInputs: %v", errs)
+			}
+			var got map[string]interface{}
+			if err := root.Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
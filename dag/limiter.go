@@ -0,0 +1,76 @@
+package dag
+
+import (
+	"ai-dag/config"
+	"context"
+	"fmt"
+)
+
+// limiter bounds how many agents run at the same time, both overall and
+// per agent type. A nil semaphore means no limit.
+type limiter struct {
+	global  chan struct{}
+	perType map[string]chan struct{}
+}
+
+func newLimiter(cfg *config.DagConfig) *limiter {
+	l := &limiter{perType: make(map[string]chan struct{})}
+	if cfg.MaxConcurrency > 0 {
+		l.global = make(chan struct{}, cfg.MaxConcurrency)
+	}
+	for agentType, limit := range cfg.Concurrency {
+		if limit > 0 {
+			l.perType[agentType] = make(chan struct{}, limit)
+		}
+	}
+	return l
+}
+
+// acquire blocks until the agent type may run another agent or ctx is
+// done. The per-type slot is taken first so that a node waiting for its
+// type does not hold on to a global slot.
+func (l *limiter) acquire(ctx context.Context, agentType string) error {
+	if sem := l.perType[agentType]; sem != nil {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if l.global != nil {
+		select {
+		case l.global <- struct{}{}:
+		case <-ctx.Done():
+			if sem := l.perType[agentType]; sem != nil {
+				<-sem
+			}
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (l *limiter) release(agentType string) {
+	if l.global != nil {
+		<-l.global
+	}
+	if sem := l.perType[agentType]; sem != nil {
+		<-sem
+	}
+}
+
+// checkConcurrency rejects negative limits and limits for unknown types.
+func checkConcurrency(cfg *config.DagConfig, known func(string) bool) error {
+	if cfg.MaxConcurrency < 0 {
+		return fmt.Errorf("maxConcurrency must not be negative, got %d", cfg.MaxConcurrency)
+	}
+	for agentType, limit := range cfg.Concurrency {
+		if !known(agentType) {
+			return fmt.Errorf("concurrency: unknown agent type %q", agentType)
+		}
+		if limit < 0 {
+			return fmt.Errorf("concurrency for %q must not be negative, got %d", agentType, limit)
+		}
+	}
+	return nil
+}
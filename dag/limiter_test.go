@@ -0,0 +1,130 @@
+package dag
+
+import (
+	"ai-dag/agents"
+	"ai-dag/config"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tryAcquire acquires a slot for agentType, giving up after a short wait.
+func tryAcquire(l *limiter, agentType string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	return l.acquire(ctx, agentType)
+}
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(&config.DagConfig{MaxConcurrency: 2, Concurrency: map[string]int{"llm": 1}})
+	if err := tryAcquire(l, "llm"); err != nil {
+		t.Fatalf("first llm: %v", err)
+	}
+	if err := tryAcquire(l, "llm"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("second llm: got %v, want it to wait for the type's slot", err)
+	}
+	// The llm waiting above did not keep a global slot
+	if err := tryAcquire(l, "http"); err != nil {
+		t.Fatalf("first http: %v", err)
+	}
+	if err := tryAcquire(l, "http"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("third agent: got %v, want it to wait for a global slot", err)
+	}
+	l.release("llm")
+	if err := tryAcquire(l, "http"); err != nil {
+		t.Fatalf("http after a release: %v", err)
+	}
+	l.release("http")
+	l.release("http")
+	if err := tryAcquire(l, "llm"); err != nil {
+		t.Fatalf("llm after releases: %v", err)
+	}
+}
+
+func TestLimiterWithoutLimits(t *testing.T) {
+	l := newLimiter(&config.DagConfig{Concurrency: map[string]int{"llm": 0}})
+	for i := 0; i < 10; i++ {
+		if err := tryAcquire(l, "llm"); err != nil {
+			t.Fatalf("acquire %d: %v", i, err)
+		}
+	}
+}
+
+func TestExecuteConcurrencyLimits(t *testing.T) {
+	var lock sync.Mutex
+	running := make(map[string]int)
+	maxRunning := make(map[string]int)
+	// track counts the agents running at once, in total and per type
+	track := func(agentType string) agentFunc {
+		return func(context.Context, map[string]interface{}) (*agents.Output, error) {
+			lock.Lock()
+			for _, key := range []string{"", agentType} {
+				running[key]++
+				if running[key] > maxRunning[key] {
+					maxRunning[key] = running[key]
+				}
+			}
+			lock.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			lock.Lock()
+			running[""]--
+			running[agentType]--
+			lock.Unlock()
+			return agents.TextOutput(agentType), nil
+		}
+	}
+	cfg := &config.DagConfig{
+		MaxConcurrency: 3,
+		Concurrency:    map[string]int{"llm": 1},
+		Agents:         make(map[string]config.AgentConfig),
+	}
+	for i := 0; i < 6; i++ {
+		cfg.Agents[fmt.Sprintf("llm%d", i)] = config.AgentConfig{Type: "llm"}
+		cfg.Agents[fmt.Sprintf("http%d", i)] = config.AgentConfig{Type: "http"}
+	}
+	d := newTestDAG(cfg, map[string]agentFunc{"llm": track("llm"), "http": track("http")})
+
+	run, err := d.Execute(context.Background())
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if len(run.Nodes) != 12 {
+		t.Errorf("got %d nodes, want 12", len(run.Nodes))
+	}
+	if maxRunning[""] > 3 {
+		t.Errorf("%d agents ran at once, want at most 3", maxRunning[""])
+	}
+	if maxRunning["llm"] > 1 {
+		t.Errorf("%d llm agents ran at once, want at most 1", maxRunning["llm"])
+	}
+}
+
+func TestCheckConcurrency(t *testing.T) {
+	known := func(agentType string) bool { return agentType == "llm" }
+	tests := []struct {
+		name string
+		cfg  config.DagConfig
+		err  string
+	}{
+		{"no limits", config.DagConfig{}, ""},
+		{"limits", config.DagConfig{MaxConcurrency: 4, Concurrency: map[string]int{"llm": 2}}, ""},
+		{"negative maxConcurrency", config.DagConfig{MaxConcurrency: -1}, "maxConcurrency must not be negative, got -1"},
+		{"negative type limit", config.DagConfig{Concurrency: map[string]int{"llm": -2}}, `concurrency for "llm" must not be negative, got -2`},
+		{"unknown type", config.DagConfig{Concurrency: map[string]int{"gpt": 1}}, `concurrency: unknown agent type "gpt"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkConcurrency(&test.cfg, known)
+			if test.err == "" {
+				if err != nil {
+					t.Errorf("checkConcurrency: %v", err)
+				}
+			} else if err == nil || err.Error() != test.err {
+				t.Errorf("got error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
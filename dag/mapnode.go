@@ -0,0 +1,165 @@
+package dag
+
+import (
+	"ai-dag/agents"
+	"ai-dag/config"
+	"ai-dag/llm"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultMapItemName    = "item"
+	defaultMapConcurrency = 4
+)
+
+// runMap runs the agent of a map node once per element of the list selected
+// by its `map.over` path. Each run receives the node's children values plus
+// the element under the `map.as` name. The outputs are collected, in the
+// order of the list, into a single JSON list; the node fails as soon as one
+// element fails. The attempts of all elements are added up.
+func (d *DAG) runMap(
+	ctx context.Context,
+	limiter *limiter,
+	agentConfig config.AgentConfig,
+	agentId string,
+	childrenResults map[string]interface{},
+) (*agents.Output, int, error) {
+	mapConfig := agentConfig.Map
+	list, err := lookupPath(childrenResults, mapConfig.Over)
+	if err != nil {
+		return nil, 0, err
+	}
+	items, ok := list.([]interface{})
+	if !ok {
+		return nil, 0, fmt.Errorf("map over %s: expected a list, got %T", mapConfig.Over, list)
+	}
+
+	itemName := mapConfig.As
+	if itemName == "" {
+		itemName = defaultMapItemName
+	}
+	parallelism := mapConfig.MaxConcurrency
+	if parallelism <= 0 {
+		parallelism = defaultMapConcurrency
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	values := make([]interface{}, len(items))
+	usages := make([]*llm.Usage, len(items))
+	var (
+		lock     sync.Mutex
+		attempts int
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	sem := make(chan struct{}, parallelism)
+
+	for i, item := range items {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		inputs := make(map[string]interface{}, len(childrenResults)+1)
+		for childID, value := range childrenResults {
+			inputs[childID] = value
+		}
+		inputs[itemName] = item
+
+		wg.Add(1)
+		go func(i int, inputs map[string]interface{}) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			output, itemAttempts, err := d.runWithRetry(ctx, limiter, agentConfig, agentId, inputs)
+			var value interface{}
+			if err == nil {
+				var result Result
+				if err = result.setOutput(output); err == nil {
+					value = result.Value
+				}
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+			attempts += itemAttempts
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("item %d: %w", i, err)
+				}
+				cancel()
+				return
+			}
+			values[i] = value
+			usages[i] = output.Usage
+		}(i, inputs)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, attempts, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, attempts, err
+	}
+
+	output := agents.JSONOutput(values)
+	output.Usage = sumUsage(usages)
+	return output, attempts, nil
+}
+
+// sumUsage adds up the token usage of several LLM calls, or returns nil if
+// none of them reported any.
+func sumUsage(usages []*llm.Usage) *llm.Usage {
+	var total *llm.Usage
+	for _, usage := range usages {
+		if usage == nil {
+			continue
+		}
+		if total == nil {
+			total = &llm.Usage{}
+		}
+		total.PromptTokens += usage.PromptTokens
+		total.CompletionTokens += usage.CompletionTokens
+		total.TotalTokens += usage.TotalTokens
+	}
+	return total
+}
+
+// checkMaps makes sure every map node reads its list from one of its own
+// children and does not hide a child behind its item name.
+func checkMaps(cfg *config.DagConfig) error {
+	for _, agentID := range sortedAgentIDs(cfg) {
+		agentConfig := cfg.Agents[agentID]
+		mapConfig := agentConfig.Map
+		if mapConfig == nil {
+			continue
+		}
+		if mapConfig.Over == "" {
+			return fmt.Errorf("agent %q: map.over is required", agentID)
+		}
+		source, _, _ := strings.Cut(mapConfig.Over, ".")
+		isChild := false
+		for _, childID := range agentConfig.Children {
+			isChild = isChild || childID == source
+			if childID == mapConfig.As {
+				return fmt.Errorf("agent %q: map.as %q shadows a child", agentID, mapConfig.As)
+			}
+		}
+		if !isChild {
+			return fmt.Errorf("agent %q: map.over %q must start with one of its children", agentID, mapConfig.Over)
+		}
+		if mapConfig.MaxConcurrency < 0 {
+			return fmt.Errorf("agent %q: map.maxConcurrency must not be negative", agentID)
+		}
+	}
+	return nil
+}
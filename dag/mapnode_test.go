@@ -0,0 +1,192 @@
+package dag
+
+import (
+	"ai-dag/agents"
+	"ai-dag/config"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// listAgent returns the given list.
+func listAgent(items ...interface{}) agentFunc {
+	return func(context.Context, map[string]interface{}) (*agents.Output, error) {
+		return agents.JSONOutput(map[string]interface{}{"results": items}), nil
+	}
+}
+
+func TestExecuteMap(t *testing.T) {
+	var lock sync.Mutex
+	running, maxRunning := 0, 0
+	d := newTestDAG(&config.DagConfig{
+		Agents: map[string]config.AgentConfig{
+			"search": {Type: "list"},
+			"verdict": {
+				Type:     "verdict",
+				Children: []string{"search"},
+				Map:      &config.MapConfig{Over: "search.results", As: "place", MaxConcurrency: 2},
+			},
+		},
+	}, map[string]agentFunc{
+		"list": listAgent(30.0, 10.0, 20.0),
+		"verdict": func(_ context.Context, childResults map[string]interface{}) (*agents.Output, error) {
+			lock.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			lock.Unlock()
+			defer func() {
+				lock.Lock()
+				running--
+				lock.Unlock()
+			}()
+			// Later items finish first
+			place := childResults["place"].(float64)
+			time.Sleep(time.Duration(place) * time.Millisecond)
+			if _, ok := childResults["search"]; !ok {
+				return nil, errors.New("no search results")
+			}
+			return agents.JSONOutput(place / 10), nil
+		},
+	})
+
+	run, err := d.Execute(context.Background())
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	result := run.Nodes["verdict"]
+	if want := []interface{}{3.0, 1.0, 2.0}; !reflect.DeepEqual(result.Value, want) {
+		t.Errorf("got %v, want %v in the order of the list", result.Value, want)
+	}
+	if result.Attempts != 3 {
+		t.Errorf("got %d attempts, want 3", result.Attempts)
+	}
+	if maxRunning > 2 {
+		t.Errorf("%d items ran at once, want at most 2", maxRunning)
+	}
+}
+
+func TestExecuteMapFailure(t *testing.T) {
+	var lock sync.Mutex
+	var ran []interface{}
+	d := newTestDAG(&config.DagConfig{
+		Agents: map[string]config.AgentConfig{
+			"search": {Type: "list"},
+			"verdict": {
+				Type:     "verdict",
+				Children: []string{"search"},
+				Map:      &config.MapConfig{Over: "search.results", MaxConcurrency: 1},
+			},
+		},
+	}, map[string]agentFunc{
+		"list": listAgent("a", "b", "c", "d"),
+		"verdict": func(_ context.Context, childResults map[string]interface{}) (*agents.Output, error) {
+			lock.Lock()
+			ran = append(ran, childResults["item"])
+			lock.Unlock()
+			if childResults["item"] == "b" {
+				return nil, errors.New("boom")
+			}
+			return agents.TextOutput("ok"), nil
+		},
+	})
+
+	run, err := d.Execute(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "item 1: boom") {
+		t.Fatalf("got error %v, want item 1 to fail", err)
+	}
+	if got := run.Nodes["verdict"].Status; got != StatusFailed {
+		t.Errorf("got status %s, want failed", got)
+	}
+	// The items after the failed one are not started
+	if want := []interface{}{"a", "b"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("ran items %v, want %v", ran, want)
+	}
+}
+
+func TestExecuteMapCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	started := make(chan interface{}, 4)
+	d := newTestDAG(&config.DagConfig{
+		Agents: map[string]config.AgentConfig{
+			"search": {Type: "list"},
+			"verdict": {
+				Type:     "verdict",
+				Children: []string{"search"},
+				Map:      &config.MapConfig{Over: "search.results", MaxConcurrency: 2},
+			},
+		},
+	}, map[string]agentFunc{
+		"list": listAgent("a", "b", "c", "d"),
+		"verdict": func(ctx context.Context, childResults map[string]interface{}) (*agents.Output, error) {
+			started <- childResults["item"]
+			if len(started) == 2 {
+				cancel()
+			}
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	})
+
+	_, err := d.Execute(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want context.Canceled", err)
+	}
+	if len(started) != 2 {
+		t.Errorf("started %d items, want the 2 running when the run was cancelled", len(started))
+	}
+}
+
+func TestExecuteMapOverNonList(t *testing.T) {
+	d := newTestDAG(&config.DagConfig{
+		Agents: map[string]config.AgentConfig{
+			"search":  {Type: "text"},
+			"verdict": {Type: "text", Children: []string{"search"}, Map: &config.MapConfig{Over: "search"}},
+		},
+	}, map[string]agentFunc{
+		"text": func(context.Context, map[string]interface{}) (*agents.Output, error) {
+			return agents.TextOutput("not a list"), nil
+		},
+	})
+	_, err := d.Execute(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "map over search: expected a list, got string") {
+		t.Errorf("got error %v, want a map over a string to fail", err)
+	}
+}
+
+func TestCheckMaps(t *testing.T) {
+	tests := []struct {
+		name     string
+		children []string
+		mapping  config.MapConfig
+		err      string
+	}{
+		{"valid", []string{"search"}, config.MapConfig{Over: "search.results", As: "place"}, ""},
+		{"no over", []string{"search"}, config.MapConfig{}, `agent "verdict": map.over is required`},
+		{"not a child", []string{"search"}, config.MapConfig{Over: "other.results"}, `agent "verdict": map.over "other.results" must start with one of its children`},
+		{"as shadows a child", []string{"search", "place"}, config.MapConfig{Over: "search", As: "place"}, `agent "verdict": map.as "place" shadows a child`},
+		{"negative concurrency", []string{"search"}, config.MapConfig{Over: "search", MaxConcurrency: -1}, `agent "verdict": map.maxConcurrency must not be negative`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mapping := test.mapping
+			cfg := &config.DagConfig{Agents: map[string]config.AgentConfig{
+				"verdict": {Children: test.children, Map: &mapping},
+			}}
+			err := checkMaps(cfg)
+			if test.err == "" {
+				if err != nil {
+					t.Errorf("checkMaps: %v", err)
+				}
+			} else if err == nil || err.Error() != test.err {
+				t.Errorf("got error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
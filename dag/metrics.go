@@ -0,0 +1,92 @@
+package dag
+
+import (
+	"ai-dag/metrics"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	runsStarted = metrics.NewCounter(
+		"ai_dag_runs_started_total",
+		"Runs started, by graph file.",
+		"graph",
+	)
+	runsSucceeded = metrics.NewCounter(
+		"ai_dag_runs_succeeded_total",
+		"Runs in which every node succeeded or was skipped, by graph file.",
+		"graph",
+	)
+	runsFailed = metrics.NewCounter(
+		"ai_dag_runs_failed_total",
+		"Runs that failed or were cancelled, by graph file.",
+		"graph",
+	)
+	nodeDuration = metrics.NewHistogram(
+		"ai_dag_node_duration_seconds",
+		"Time taken by nodes that ran, retries included, by agent type and status.",
+		[]float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+		"type", "status",
+	)
+	nodeRetries = metrics.NewCounter(
+		"ai_dag_node_retries_total",
+		"Agent executions retried after a transient failure, by agent type.",
+		"type",
+	)
+)
+
+// MetricsObserver records the runs and nodes of a DAG in the metrics of
+// the metrics package.
+type MetricsObserver struct {
+	lock  sync.Mutex
+	graph string
+	types map[string]string
+}
+
+func NewMetricsObserver() *MetricsObserver {
+	return &MetricsObserver{}
+}
+
+func (m *MetricsObserver) OnRunStart(d *DAG) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.graph = filepath.Base(d.Config.Path)
+	m.types = make(map[string]string, len(d.Config.Agents))
+	for agentID, agentConfig := range d.Config.Agents {
+		m.types[agentID] = agentConfig.Type
+	}
+	runsStarted.Inc(m.graph)
+}
+
+func (m *MetricsObserver) OnNodeStart(string) {}
+
+func (m *MetricsObserver) OnNodeRetry(agentId string, attempt int, delay time.Duration, err error) {
+	nodeRetries.Inc(m.agentType(agentId))
+}
+
+func (m *MetricsObserver) OnNodeWarning(string, error) {}
+
+func (m *MetricsObserver) OnNodeFinish(result *Result) {
+	// Nodes that never ran have no duration worth recording
+	if result.StartedAt.IsZero() {
+		return
+	}
+	nodeDuration.Observe(result.Duration.Seconds(), m.agentType(result.AgentId), string(result.Status))
+}
+
+func (m *MetricsObserver) OnRunFinish(run *RunResult, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if err != nil {
+		runsFailed.Inc(m.graph)
+	} else {
+		runsSucceeded.Inc(m.graph)
+	}
+}
+
+func (m *MetricsObserver) agentType(agentId string) string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.types[agentId]
+}
@@ -0,0 +1,219 @@
+package dag
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Observer is notified as a run progresses. Register observers in
+// DAG.Observers before calling Execute. Nodes run concurrently, so the
+// node methods may be called from several goroutines at once; observers
+// must do their own locking and should return quickly.
+type Observer interface {
+	// OnRunStart is called once Execute has checked the graph, before any
+	// node runs.
+	OnRunStart(d *DAG)
+	// OnNodeStart is called when a node whose children are all available
+	// starts, before its cache is looked up. Nodes that are skipped, fail
+	// because of a child or are provided by the caller never start.
+	OnNodeStart(agentId string)
+	// OnNodeRetry is called when the agent of a node failed with a
+	// transient error and will run again after delay. attempt is the number
+	// of the attempt that failed.
+	OnNodeRetry(agentId string, attempt int, delay time.Duration, err error)
+	// OnNodeWarning is called when something went wrong around a node
+	// without failing it, such as a cache entry or checkpoint that could
+	// not be read or written.
+	OnNodeWarning(agentId string, err error)
+	// OnNodeFinish is called once for every node that reaches a final
+	// status, whether it ran or not.
+	OnNodeFinish(result *Result)
+	// OnRunFinish is called when Execute returns, with its results.
+	OnRunFinish(run *RunResult, err error)
+}
+
+// NopObserver ignores every event. Embed it to implement only some of the
+// Observer methods.
+type NopObserver struct{}
+
+func (NopObserver) OnRunStart(*DAG)                               {}
+func (NopObserver) OnNodeStart(string)                            {}
+func (NopObserver) OnNodeRetry(string, int, time.Duration, error) {}
+func (NopObserver) OnNodeWarning(string, error)                   {}
+func (NopObserver) OnNodeFinish(*Result)                          {}
+func (NopObserver) OnRunFinish(*RunResult, error)                 {}
+
+// notify calls fn for every registered observer.
+func (d *DAG) notify(fn func(Observer)) {
+	for _, observer := range d.Observers {
+		fn(observer)
+	}
+}
+
+// ConsoleObserver prints a line per node as it starts, retries and
+// finishes, with the number of finished nodes out of the total.
+type ConsoleObserver struct {
+	lock     sync.Mutex
+	w        io.Writer
+	total    int
+	finished int
+}
+
+func NewConsoleObserver(w io.Writer) *ConsoleObserver {
+	return &ConsoleObserver{w: w}
+}
+
+func (c *ConsoleObserver) OnRunStart(d *DAG) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.total = len(d.needed())
+	c.finished = 0
+}
+
+func (c *ConsoleObserver) OnNodeStart(agentId string) {
+	c.progress(false, "%s started", agentId)
+}
+
+func (c *ConsoleObserver) OnNodeRetry(agentId string, attempt int, delay time.Duration, err error) {
+	c.progress(false, "%s failed attempt %d, retrying in %s: %s", agentId, attempt, delay.Round(time.Millisecond), err)
+}
+
+func (c *ConsoleObserver) OnNodeWarning(agentId string, err error) {
+	c.progress(false, "%s warning: %s", agentId, err)
+}
+
+func (c *ConsoleObserver) OnNodeFinish(result *Result) {
+	outcome := string(result.Status)
+	switch {
+	case result.Cached:
+		outcome += " (cached)"
+	case result.Status == StatusSucceeded || result.Status == StatusFailed:
+		outcome += " in " + result.Duration.Round(time.Millisecond).String()
+	}
+	if result.Err != nil {
+		outcome += ": " + result.Err.Error()
+	}
+	c.progress(true, "%s %s", result.AgentId, outcome)
+}
+
+func (c *ConsoleObserver) OnRunFinish(run *RunResult, err error) {
+	if run == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	counts := make(map[Status]int)
+	for _, result := range run.Nodes {
+		counts[result.Status]++
+	}
+	summary := fmt.Sprintf("%d succeeded", counts[StatusSucceeded])
+	for _, status := range []Status{StatusFailed, StatusDependencyFailed, StatusSkipped} {
+		if counts[status] > 0 {
+			summary += fmt.Sprintf(", %d %s", counts[status], status)
+		}
+	}
+	if unfinished := c.total - len(run.Nodes); unfinished > 0 {
+		summary += fmt.Sprintf(", %d unfinished", unfinished)
+	}
+	_, _ = fmt.Fprintf(c.w, "Run finished: %s\n", summary)
+}
+
+// progress prints a line prefixed with the number of finished nodes,
+// counting one more if finish is set. It holds the lock while writing so
+// that lines from concurrent nodes are not interleaved.
+func (c *ConsoleObserver) progress(finish bool, format string, args ...interface{}) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if finish {
+		c.finished++
+	}
+	args = append([]interface{}{c.finished, c.total}, args...)
+	_, _ = fmt.Fprintf(c.w, "[%d/%d] "+format+"\n", args...)
+}
+
+// JSONLinesObserver writes every event as a JSON object on its own line,
+// for logs that other tools consume.
+type JSONLinesObserver struct {
+	lock    sync.Mutex
+	encoder *json.Encoder
+}
+
+// jsonEvent is one line written by JSONLinesObserver.
+type jsonEvent struct {
+	Time       time.Time `json:"time"`
+	Event      string    `json:"event"`
+	RunId      string    `json:"runId,omitempty"`
+	Graph      string    `json:"graph,omitempty"`
+	AgentId    string    `json:"agentId,omitempty"`
+	Status     Status    `json:"status,omitempty"`
+	Attempt    int       `json:"attempt,omitempty"`
+	Attempts   int       `json:"attempts,omitempty"`
+	DelayMs    int64     `json:"delayMs,omitempty"`
+	DurationMs int64     `json:"durationMs,omitempty"`
+	Cached     bool      `json:"cached,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+func NewJSONLinesObserver(w io.Writer) *JSONLinesObserver {
+	return &JSONLinesObserver{encoder: json.NewEncoder(w)}
+}
+
+func (j *JSONLinesObserver) OnRunStart(d *DAG) {
+	event := jsonEvent{Event: "run_start", Graph: d.Config.Path}
+	if d.Checkpoint != nil {
+		event.RunId = d.Checkpoint.RunId
+	}
+	j.write(event)
+}
+
+func (j *JSONLinesObserver) OnNodeStart(agentId string) {
+	j.write(jsonEvent{Event: "node_start", AgentId: agentId})
+}
+
+func (j *JSONLinesObserver) OnNodeRetry(agentId string, attempt int, delay time.Duration, err error) {
+	j.write(jsonEvent{
+		Event:   "node_retry",
+		AgentId: agentId,
+		Attempt: attempt,
+		DelayMs: delay.Milliseconds(),
+		Error:   err.Error(),
+	})
+}
+
+func (j *JSONLinesObserver) OnNodeWarning(agentId string, err error) {
+	j.write(jsonEvent{Event: "node_warning", AgentId: agentId, Error: err.Error()})
+}
+
+func (j *JSONLinesObserver) OnNodeFinish(result *Result) {
+	event := jsonEvent{
+		Event:      "node_finish",
+		AgentId:    result.AgentId,
+		Status:     result.Status,
+		Attempts:   result.Attempts,
+		DurationMs: result.Duration.Milliseconds(),
+		Cached:     result.Cached,
+	}
+	if result.Err != nil {
+		event.Error = result.Err.Error()
+	}
+	j.write(event)
+}
+
+func (j *JSONLinesObserver) OnRunFinish(run *RunResult, err error) {
+	event := jsonEvent{Event: "run_finish", Status: StatusSucceeded}
+	if err != nil {
+		event.Status = StatusFailed
+		event.Error = err.Error()
+	}
+	j.write(event)
+}
+
+func (j *JSONLinesObserver) write(event jsonEvent) {
+	event.Time = time.Now()
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	_ = j.encoder.Encode(event)
+}
@@ -0,0 +1,37 @@
+package dag
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// lookupPath resolves a dotted path such as "nearBySearch.results" or
+// "nearBySearch.results.0.name" against node values. The first segment
+// names a node; the following ones are map keys or list indexes.
+func lookupPath(values map[string]interface{}, path string) (interface{}, error) {
+	segments := strings.Split(path, ".")
+	value, ok := values[segments[0]]
+	if !ok {
+		return nil, fmt.Errorf("%s: no value for %q", path, segments[0])
+	}
+	for i, segment := range segments[1:] {
+		at := strings.Join(segments[:i+1], ".")
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value, ok = v[segment]
+			if !ok {
+				return nil, fmt.Errorf("%s: %s has no key %q", path, at, segment)
+			}
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, fmt.Errorf("%s: invalid index %q into %s of length %d", path, segment, at, len(v))
+			}
+			value = v[index]
+		default:
+			return nil, fmt.Errorf("%s: cannot look up %q in %s, a %T", path, segment, at, value)
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,171 @@
+package dag
+
+import (
+	"ai-dag/agents"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Plan describes what a run would do without doing it: the nodes grouped
+// into levels that can execute in parallel, each with what its agent would
+// request.
+type Plan struct {
+	Levels [][]*PlanNode
+}
+
+// PlanNode is one node of a plan.
+type PlanNode struct {
+	AgentId  string
+	Type     string
+	Children []string
+	Details  []agents.Detail
+}
+
+// levels groups the nodes by the length of the longest path to a node
+// without children: level 0 holds the nodes without children, level n the
+// nodes whose deepest child is at level n-1. Nodes on the same level never
+// depend on each other.
+func (d *DAG) levels() ([][]string, error) {
+	executionOrder, err := d.topologicalSort()
+	if err != nil {
+		return nil, err
+	}
+	level := make(map[string]int, len(executionOrder))
+	levels := make([][]string, 0)
+	for _, agentID := range executionOrder {
+		nodeLevel := 0
+		for _, childID := range d.Config.Agents[agentID].Children {
+			if level[childID]+1 > nodeLevel {
+				nodeLevel = level[childID] + 1
+			}
+		}
+		level[agentID] = nodeLevel
+		for len(levels) <= nodeLevel {
+			levels = append(levels, nil)
+		}
+		levels[nodeLevel] = append(levels[nodeLevel], agentID)
+	}
+	for _, ids := range levels {
+		sort.Strings(ids)
+	}
+	return levels, nil
+}
+
+// Plan builds the plan of the graph. It makes no network calls.
+func (d *DAG) Plan() (*Plan, error) {
+	levels, err := d.levels()
+	if err != nil {
+		return nil, err
+	}
+	if err := d.loadSecrets(); err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{Levels: make([][]*PlanNode, len(levels))}
+	for i, ids := range levels {
+		for _, agentID := range ids {
+			node, err := d.planNode(agentID)
+			if err != nil {
+				return nil, fmt.Errorf("agent %q: %w", agentID, err)
+			}
+			plan.Levels[i] = append(plan.Levels[i], node)
+		}
+	}
+	return plan, nil
+}
+
+func (d *DAG) planNode(agentID string) (*PlanNode, error) {
+	agentConfig := d.Config.Agents[agentID]
+	node := &PlanNode{
+		AgentId:  agentID,
+		Type:     agentConfig.Type,
+		Children: agentConfig.Children,
+	}
+
+	if _, ok := d.Provided[agentID]; ok {
+		node.Details = append(node.Details, agents.Detail{Name: "provided", Value: "result supplied, not executed"})
+		return node, nil
+	}
+	if !d.needed()[agentID] {
+		node.Details = append(node.Details, agents.Detail{Name: "unused", Value: "only needed by provided nodes, not executed"})
+		return node, nil
+	}
+	if agentConfig.When != "" {
+		node.Details = append(node.Details, agents.Detail{Name: "when", Value: agentConfig.When})
+	}
+	inputs := append([]string(nil), agentConfig.Children...)
+	if agentConfig.Map != nil {
+		itemName := agentConfig.Map.As
+		if itemName == "" {
+			itemName = defaultMapItemName
+		}
+		inputs = append(inputs, itemName)
+		node.Details = append(node.Details, agents.Detail{Name: "map", Value: fmt.Sprintf("for each %s in %s", itemName, agentConfig.Map.Over)})
+	}
+	if agentConfig.Timeout > 0 {
+		node.Details = append(node.Details, agents.Detail{Name: "timeout", Value: agentConfig.Timeout.String()})
+	}
+	if agentConfig.Retry != nil && agentConfig.Retry.MaxAttempts > 1 {
+		node.Details = append(node.Details, agents.Detail{Name: "retry", Value: fmt.Sprintf("up to %d attempts", agentConfig.Retry.MaxAttempts)})
+	}
+	if agentConfig.Cache != nil {
+		node.Details = append(node.Details, agents.Detail{Name: "cache", Value: "ttl " + agentConfig.Cache.TTL.String()})
+	}
+	if agentConfig.Secret != "" {
+		// Only whether the secret is found is shown, never its value
+		status := agentConfig.Secret
+		if _, ok, err := d.Secrets.Lookup(agentConfig.Secret); err != nil {
+			status += " (" + err.Error() + ")"
+		} else if !ok {
+			status += " (not found)"
+		}
+		node.Details = append(node.Details, agents.Detail{Name: "secret", Value: status})
+	}
+
+	agent, err := d.Registry.New(agentConfig)
+	if err != nil {
+		return nil, err
+	}
+	if planner, ok := agent.(agents.Planner); ok {
+		details, err := planner.Plan(d.Config, agentID, inputs)
+		if err != nil {
+			return nil, err
+		}
+		node.Details = append(node.Details, details...)
+	}
+	return node, nil
+}
+
+// Write prints the plan in a human readable form.
+func (p *Plan) Write(w io.Writer) error {
+	for i, level := range p.Levels {
+		parallel := ""
+		if len(level) > 1 {
+			parallel = fmt.Sprintf(", %d nodes in parallel", len(level))
+		}
+		if _, err := fmt.Fprintf(w, "Level %d%s\n", i, parallel); err != nil {
+			return err
+		}
+		for _, node := range level {
+			line := fmt.Sprintf("  %s (%s)", node.AgentId, node.Type)
+			if len(node.Children) > 0 {
+				line += " <- " + strings.Join(node.Children, ", ")
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+			for _, detail := range node.Details {
+				value := strings.ReplaceAll(strings.TrimRight(detail.Value, "\n"), "\n", "\n      ")
+				if !strings.HasPrefix(value, "\n") {
+					value = " " + value
+				}
+				if _, err := fmt.Fprintf(w, "    %s:%s\n", detail.Name, value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package dag
+
+import (
+	"ai-dag/agents"
+	"ai-dag/config"
+	"ai-dag/llm"
+	"ai-dag/tracing"
+	"ai-dag/utils"
+	"fmt"
+	"time"
+)
+
+// Status describes how a node finished.
+type Status string
+
+const (
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	// StatusDependencyFailed marks nodes that never ran because one of their
+	// children did not succeed.
+	StatusDependencyFailed Status = "dependency failed"
+	// StatusSkipped marks nodes whose when condition was false, or that
+	// depend on such a node that has no default value.
+	StatusSkipped Status = "skipped"
+)
+
+// Result is the outcome of a single node. It is what parents receive from
+// their children and what Execute returns.
+type Result struct {
+	AgentId string
+	Status  Status
+	// Value is the agent's output in the generic form encoding/json decodes
+	// into: a string, float64, bool, nil, []interface{} or
+	// map[string]interface{}.
+	Value       interface{}
+	ContentType string
+	StartedAt   time.Time
+	Duration    time.Duration
+	// Usage is set for agents that call an LLM
+	Usage *llm.Usage
+	Err   error
+	// Attempts is the number of times the agent was executed, including
+	// retries; zero if it never ran.
+	Attempts int
+	// Cached is set when the value was served from the cache
+	Cached bool
+	// span traced the node, if tracing is on; parents link to it
+	span *tracing.Span
+}
+
+// setOutput stores an agent's output, converting its value to the generic
+// JSON form shared by all results.
+func (r *Result) setOutput(output *agents.Output) error {
+	if output == nil {
+		return fmt.Errorf("agent returned no output")
+	}
+	value, err := utils.ToJSONValue(output.Value)
+	if err != nil {
+		return fmt.Errorf("agent output is not JSON-compatible: %w", err)
+	}
+	r.Value = value
+	r.ContentType = output.ContentType
+	r.Usage = output.Usage
+	return nil
+}
+
+// skip marks the result as skipped for the given reason, handing the node's
+// default value, if any, to its parents.
+func (r *Result) skip(agentConfig config.AgentConfig, reason error) {
+	r.Status = StatusSkipped
+	r.Err = reason
+	if agentConfig.Default != nil {
+		r.Value = agentConfig.Default
+		if value, err := utils.ToJSONValue(agentConfig.Default); err == nil {
+			r.Value = value
+		}
+		r.ContentType = contentTypeOf(r.Value)
+	}
+}
+
+// contentTypeOf picks the content type for a value that did not come from
+// an agent.
+func contentTypeOf(value interface{}) string {
+	if _, ok := value.(string); ok {
+		return agents.ContentTypeText
+	}
+	return agents.ContentTypeJSON
+}
+
+// Text renders the value for display: strings as they are, structured
+// values as indented JSON.
+func (r *Result) Text() string {
+	return utils.ToText(r.Value)
+}
+
+// RunResult collects the outcome of a run, keyed by node ID. Outputs holds
+// the subset of Nodes that are the graph's outputs: the nodes listed under
+// `outputs:` in graph.yaml, or every sink of the graph if none are listed.
+type RunResult struct {
+	Nodes   map[string]*Result
+	Outputs map[string]*Result
+}
+
+// NodeError is returned from Execute for every node whose agent failed.
+type NodeError struct {
+	AgentId string
+	Err     error
+}
+
+func (e *NodeError) Error() string {
+	return fmt.Sprintf("agent %q failed: %v", e.AgentId, e.Err)
+}
+
+func (e *NodeError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,128 @@
+package dag
+
+import (
+	"ai-dag/agents"
+	"ai-dag/config"
+	"ai-dag/utils"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+)
+
+const (
+	defaultInitialBackoff = 500 * time.Millisecond
+	defaultMaxBackoff     = 30 * time.Second
+)
+
+var defaultRetryableStatuses = []int{429, 500, 502, 503, 504}
+
+// runWithRetry runs the agent of a node until it succeeds, fails with a
+// non-transient error or runs out of attempts under the node's retry policy.
+// Each attempt holds a concurrency slot, which is given back while waiting
+// for the next attempt. It returns the output of the last attempt and the
+// number of attempts made.
+func (d *DAG) runWithRetry(
+	ctx context.Context,
+	limiter *limiter,
+	agentConfig config.AgentConfig,
+	agentId string,
+	childrenResults map[string]interface{},
+) (*agents.Output, int, error) {
+	policy := agentConfig.Retry
+	maxAttempts := 1
+	if policy != nil && policy.MaxAttempts > 1 {
+		maxAttempts = policy.MaxAttempts
+	}
+
+	attempt := 1
+	for {
+		if err := limiter.acquire(ctx, agentConfig.Type); err != nil {
+			return nil, attempt - 1, err
+		}
+		output, err := d.runAgent(ctx, agentConfig, agentId, childrenResults)
+		limiter.release(agentConfig.Type)
+		if err == nil {
+			return output, attempt, nil
+		}
+		if attempt >= maxAttempts || ctx.Err() != nil || !isRetryable(err, policy) {
+			if attempt > 1 {
+				err = fmt.Errorf("after %d attempts: %w", attempt, err)
+			}
+			return nil, attempt, err
+		}
+
+		delay := backoff(policy, attempt)
+		d.notify(func(o Observer) { o.OnNodeRetry(agentId, attempt, delay, err) })
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, attempt, err
+		}
+		attempt++
+	}
+}
+
+// isRetryable reports whether err looks transient: an HTTP error with one of
+// the policy's retryable statuses, a timeout, including the node's own
+// timeout, or a failure to reach the server, such as a refused connection
+// or a failed DNS lookup. Other errors wrapped in a *url.Error, such as an
+// unsupported protocol scheme or an invalid certificate, are not retried.
+func isRetryable(err error, policy *config.RetryPolicy) bool {
+	var httpErr *utils.HTTPError
+	if errors.As(err, &httpErr) {
+		statuses := defaultRetryableStatuses
+		if policy != nil && len(policy.RetryableStatuses) > 0 {
+			statuses = policy.RetryableStatuses
+		}
+		for _, status := range statuses {
+			if httpErr.StatusCode == status {
+				return true
+			}
+		}
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
+
+// backoff returns how long to wait after the given failed attempt:
+// exponential growth from InitialBackoff capped at MaxBackoff, randomized by
+// Jitter.
+func backoff(policy *config.RetryPolicy, attempt int) time.Duration {
+	initial, maxBackoff := defaultInitialBackoff, defaultMaxBackoff
+	jitter := 0.0
+	if policy != nil {
+		if policy.InitialBackoff > 0 {
+			initial = policy.InitialBackoff
+		}
+		if policy.MaxBackoff > 0 {
+			maxBackoff = policy.MaxBackoff
+		}
+		jitter = policy.Jitter
+	}
+
+	delay := initial
+	for i := 1; i < attempt && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	if jitter > 0 {
+		delay += time.Duration(float64(delay) * jitter * (2*rand.Float64() - 1))
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return delay
+}
@@ -0,0 +1,111 @@
+package dag
+
+import (
+	"ai-dag/config"
+	"ai-dag/utils"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  *config.RetryPolicy
+		attempt int
+		want    time.Duration
+	}{
+		{"defaults, first retry", nil, 1, defaultInitialBackoff},
+		{"defaults, doubles", nil, 3, 4 * defaultInitialBackoff},
+		{"defaults, capped", nil, 20, defaultMaxBackoff},
+		{"empty policy uses defaults", &config.RetryPolicy{}, 2, 2 * defaultInitialBackoff},
+		{"initial", &config.RetryPolicy{InitialBackoff: time.Second}, 1, time.Second},
+		{"doubles from initial", &config.RetryPolicy{InitialBackoff: time.Second}, 4, 8 * time.Second},
+		{"capped at max", &config.RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}, 4, 5 * time.Second},
+		{"max below initial", &config.RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 100 * time.Millisecond}, 1, 100 * time.Millisecond},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := backoff(test.policy, test.attempt); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	tests := []struct {
+		jitter   float64
+		min, max time.Duration
+	}{
+		{0.5, 2 * time.Second, 6 * time.Second},
+		{1, 0, 8 * time.Second},
+		// Jitter above 1 could go negative and is clamped to zero
+		{2, 0, 12 * time.Second},
+	}
+	for _, test := range tests {
+		policy := &config.RetryPolicy{InitialBackoff: time.Second, Jitter: test.jitter}
+		for i := 0; i < 100; i++ {
+			if got := backoff(policy, 3); got < test.min || got > test.max {
+				t.Fatalf("jitter %v: got %v, want within [%v, %v]", test.jitter, got, test.min, test.max)
+			}
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	// A server that takes longer to answer than the client waits
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	// An address nothing listens on
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := "http://" + listener.Addr().String()
+	listener.Close()
+
+	request := func(client *http.Client, url string) error {
+		resp, err := client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			return errors.New("request succeeded")
+		}
+		return fmt.Errorf("request failed: %w", err)
+	}
+	tests := []struct {
+		name   string
+		err    error
+		policy *config.RetryPolicy
+		want   bool
+	}{
+		{"retryable status", &utils.HTTPError{StatusCode: 503}, nil, true},
+		{"other status", &utils.HTTPError{StatusCode: 404}, nil, false},
+		{"status of the policy", &utils.HTTPError{StatusCode: 404}, &config.RetryPolicy{RetryableStatuses: []int{404}}, true},
+		{"status left out by the policy", &utils.HTTPError{StatusCode: 503}, &config.RetryPolicy{RetryableStatuses: []int{429}}, false},
+		{"node timeout", fmt.Errorf("agent: %w", context.DeadlineExceeded), nil, true},
+		{"client timeout", request(&http.Client{Timeout: 10 * time.Millisecond}, slow.URL), nil, true},
+		{"connection refused", request(http.DefaultClient, refused), nil, true},
+		{"unsupported protocol scheme", request(http.DefaultClient, "ftp://example.com"), nil, false},
+		{"invalid URL", request(http.DefaultClient, "http://[::1"), nil, false},
+		{"cancelled", context.Canceled, nil, false},
+		{"other error", errors.New("boom"), nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := isRetryable(test.err, test.policy); got != test.want {
+				t.Errorf("isRetryable(%v) = %v, want %v", test.err, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package dag
+
+import (
+	"ai-dag/config"
+	"fmt"
+	"sort"
+)
+
+// SelectTargets returns a copy of cfg reduced to the target nodes and
+// everything they depend on, with the targets as the graph's outputs. It
+// is used to run a single node without running the nodes built on top of
+// it.
+func SelectTargets(cfg *config.DagConfig, targets []string) (*config.DagConfig, error) {
+	keep := make(map[string]bool)
+	var visit func(string)
+	visit = func(agentID string) {
+		if keep[agentID] {
+			return
+		}
+		keep[agentID] = true
+		for _, childID := range cfg.Agents[agentID].Children {
+			visit(childID)
+		}
+	}
+	for _, target := range targets {
+		if _, ok := cfg.Agents[target]; !ok {
+			return nil, fmt.Errorf("target %q is not a defined agent", target)
+		}
+		visit(target)
+	}
+
+	selected := *cfg
+	selected.Agents = make(map[string]config.AgentConfig, len(keep))
+	for agentID := range keep {
+		selected.Agents[agentID] = cfg.Agents[agentID]
+	}
+	selected.Outputs = append([]string(nil), targets...)
+	sort.Strings(selected.Outputs)
+	return &selected, nil
+}
+
+// ReuseFrom returns the nodes to re-execute and the nodes to reuse when
+// re-executing from the given node. The node itself and the nodes that
+// depend on it, directly or not, are re-executed; the nodes they depend on
+// are reused. Nodes in neither set are unrelated to from and run as usual.
+func ReuseFrom(cfg *config.DagConfig, from string) (rerun map[string]bool, reuse map[string]bool, err error) {
+	if _, ok := cfg.Agents[from]; !ok {
+		return nil, nil, fmt.Errorf("from %q is not a defined agent", from)
+	}
+	parents := make(map[string][]string, len(cfg.Agents))
+	for agentID, agentConfig := range cfg.Agents {
+		for _, childID := range agentConfig.Children {
+			parents[childID] = append(parents[childID], agentID)
+		}
+	}
+
+	rerun = make(map[string]bool)
+	var visitParents func(string)
+	visitParents = func(agentID string) {
+		if rerun[agentID] {
+			return
+		}
+		rerun[agentID] = true
+		for _, parentID := range parents[agentID] {
+			visitParents(parentID)
+		}
+	}
+	visitParents(from)
+
+	reuse = make(map[string]bool)
+	var visitChildren func(string)
+	visitChildren = func(agentID string) {
+		for _, childID := range cfg.Agents[agentID].Children {
+			if rerun[childID] || reuse[childID] {
+				continue
+			}
+			reuse[childID] = true
+			visitChildren(childID)
+		}
+	}
+	for agentID := range rerun {
+		visitChildren(agentID)
+	}
+	return rerun, reuse, nil
+}
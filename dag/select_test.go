@@ -0,0 +1,166 @@
+package dag
+
+import (
+	"ai-dag/agents"
+	"ai-dag/config"
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// selectGraph is fetch -> analyze -> report, with score also built on
+// fetch and an unrelated other.
+func selectGraph() *config.DagConfig {
+	return &config.DagConfig{
+		Agents: map[string]config.AgentConfig{
+			"fetch":   {Type: "fetch"},
+			"analyze": {Type: "analyze", Children: []string{"fetch"}},
+			"score":   {Type: "score", Children: []string{"fetch"}},
+			"report":  {Type: "report", Children: []string{"analyze", "score"}},
+			"other":   {Type: "other"},
+		},
+		Outputs: []string{"report"},
+	}
+}
+
+// keys returns the keys of a set, sorted.
+func keys(set map[string]bool) []string {
+	ids := make([]string, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestSelectTargets(t *testing.T) {
+	cfg := selectGraph()
+	selected, err := SelectTargets(cfg, []string{"score", "analyze"})
+	if err != nil {
+		t.Fatalf("SelectTargets: %v", err)
+	}
+	agentIDs := make(map[string]bool)
+	for agentID := range selected.Agents {
+		agentIDs[agentID] = true
+	}
+	if got, want := keys(agentIDs), []string{"analyze", "fetch", "score"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got agents %v, want %v", got, want)
+	}
+	if want := []string{"analyze", "score"}; !reflect.DeepEqual(selected.Outputs, want) {
+		t.Errorf("got outputs %v, want %v", selected.Outputs, want)
+	}
+	if len(cfg.Agents) != 5 || !reflect.DeepEqual(cfg.Outputs, []string{"report"}) {
+		t.Error("SelectTargets changed the original graph")
+	}
+
+	if _, err := SelectTargets(cfg, []string{"missing"}); err == nil || err.Error() != `target "missing" is not a defined agent` {
+		t.Errorf("got error %v for an unknown target", err)
+	}
+}
+
+func TestReuseFrom(t *testing.T) {
+	tests := []struct {
+		from         string
+		rerun, reuse []string
+	}{
+		{"fetch", []string{"analyze", "fetch", "report", "score"}, []string{}},
+		{"analyze", []string{"analyze", "report"}, []string{"fetch", "score"}},
+		{"report", []string{"report"}, []string{"analyze", "fetch", "score"}},
+		{"other", []string{"other"}, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.from, func(t *testing.T) {
+			rerun, reuse, err := ReuseFrom(selectGraph(), test.from)
+			if err != nil {
+				t.Fatalf("ReuseFrom: %v", err)
+			}
+			if got := keys(rerun); !reflect.DeepEqual(got, test.rerun) {
+				t.Errorf("got rerun %v, want %v", got, test.rerun)
+			}
+			if got := keys(reuse); !reflect.DeepEqual(got, test.reuse) {
+				t.Errorf("got reuse %v, want %v", got, test.reuse)
+			}
+		})
+	}
+
+	if _, _, err := ReuseFrom(selectGraph(), "missing"); err == nil || err.Error() != `from "missing" is not a defined agent` {
+		t.Errorf("got error %v for an unknown node", err)
+	}
+}
+
+func TestExecuteRerun(t *testing.T) {
+	cache := NewCache(t.TempDir())
+	version := "v1"
+	var lock sync.Mutex
+	runs := make(map[string]int)
+	// record counts the runs of the agent of the given type
+	record := func(agentType string) {
+		lock.Lock()
+		defer lock.Unlock()
+		runs[agentType]++
+	}
+	newDAG := func() *DAG {
+		d := newTestDAG(&config.DagConfig{
+			Agents: map[string]config.AgentConfig{
+				"fetch":   {Type: "fetch", Cache: &config.CacheConfig{}},
+				"analyze": {Type: "analyze", Children: []string{"fetch"}, Cache: &config.CacheConfig{}},
+				"other":   {Type: "other"},
+			},
+		}, map[string]agentFunc{
+			"fetch": func(context.Context, map[string]interface{}) (*agents.Output, error) {
+				record("fetch")
+				return agents.TextOutput("data"), nil
+			},
+			"analyze": func(context.Context, map[string]interface{}) (*agents.Output, error) {
+				record("analyze")
+				return agents.TextOutput("analysis " + version), nil
+			},
+			"other": func(context.Context, map[string]interface{}) (*agents.Output, error) {
+				record("other")
+				return agents.TextOutput("other"), nil
+			},
+		})
+		d.Cache = cache
+		return d
+	}
+	if _, err := newDAG().Execute(context.Background()); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+
+	// Rerunning from analyze executes it despite its cache entry, reuses
+	// fetch and runs the unrelated other as usual
+	d := newDAG()
+	rerun, reuse, err := ReuseFrom(d.Config, "analyze")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Rerun, d.Reuse = rerun, reuse
+	version = "v2"
+	for name := range runs {
+		delete(runs, name)
+	}
+	run, err := d.Execute(context.Background())
+	if err != nil {
+		t.Fatalf("rerun: %v", err)
+	}
+	if want := map[string]int{"analyze": 1, "other": 1}; !reflect.DeepEqual(runs, want) {
+		t.Errorf("rerun ran %v, want %v", runs, want)
+	}
+	if result := run.Nodes["analyze"]; result.Cached || result.Value != "analysis v2" {
+		t.Errorf("got analyze %v, cached %v, want it executed", result.Value, result.Cached)
+	}
+	if !run.Nodes["fetch"].Cached {
+		t.Error("fetch was not reused from the cache")
+	}
+
+	// The new output replaced the cached one
+	run, err = newDAG().Execute(context.Background())
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if result := run.Nodes["analyze"]; !result.Cached || result.Value != "analysis v2" {
+		t.Errorf("got analyze %v, cached %v, want the rerun's output from the cache", result.Value, result.Cached)
+	}
+}
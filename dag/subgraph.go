@@ -0,0 +1,197 @@
+package dag
+
+import (
+	"ai-dag/agents"
+	"ai-dag/config"
+	"ai-dag/llm"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// SubgraphType is the agent type of nodes that run another graph file.
+const SubgraphType = "subgraph"
+
+func init() {
+	agents.Register(SubgraphType, func(config.AgentConfig) (agents.Agent, error) {
+		return &subgraphAgent{}, nil
+	}, "graph")
+}
+
+// parentDAGKey is the context key under which Execute stores the running
+// DAG, so that nested DAGs inherit its registry, cache and, unless they
+// list their own, secrets.
+type parentDAGKey struct{}
+
+// subgraphAgent runs the graph referenced by a node as a nested DAG. The
+// node's `inputs:` set the nested graph's inputs, its `provide:` supplies
+// the results of nodes of the nested graph from the node's children, and
+// its result maps each output of the nested graph to its value.
+type subgraphAgent struct{}
+
+func (s *subgraphAgent) Do(
+	ctx context.Context,
+	dagConfig *config.DagConfig,
+	agentId string,
+	childResults map[string]interface{},
+) (*agents.Output, error) {
+	agentConfig := dagConfig.Agents[agentId]
+	nested := agentConfig.Subgraph
+	if nested == nil {
+		// Not loaded through LoadDAG, e.g. built in code
+		var err error
+		nested, err = LoadDAGWithInputs(subgraphPath(dagConfig, agentConfig.Graph), agentConfig.Inputs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	provided := make(map[string]*Result, len(agentConfig.Provide))
+	for nestedID, path := range agentConfig.Provide {
+		value, err := lookupPath(childResults, path)
+		if err != nil {
+			return nil, fmt.Errorf("provide %s: %w", nestedID, err)
+		}
+		provided[nestedID] = &Result{
+			Status:      StatusSucceeded,
+			Value:       value,
+			ContentType: contentTypeOf(value),
+		}
+	}
+
+	sub := NewDAG(nested)
+	sub.Provided = provided
+	if parent, ok := ctx.Value(parentDAGKey{}).(*DAG); ok {
+		sub.Registry = parent.Registry
+		sub.Cache = parent.Cache
+		if len(nested.Secrets) == 0 {
+			sub.Secrets = parent.Secrets
+		}
+	}
+	run, err := sub.Execute(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("subgraph %s: %w", agentConfig.Graph, err)
+	}
+
+	values := make(map[string]interface{}, len(run.Outputs))
+	usages := make([]*llm.Usage, 0, len(run.Nodes))
+	for outputID, result := range run.Outputs {
+		values[outputID] = result.Value
+	}
+	for _, result := range run.Nodes {
+		usages = append(usages, result.Usage)
+	}
+	output := agents.JSONOutput(values)
+	output.Usage = sumUsage(usages)
+	return output, nil
+}
+
+// Plan shows the nested graph's file, the inputs and results supplied to
+// it and its own plan, indented.
+func (s *subgraphAgent) Plan(
+	dagConfig *config.DagConfig,
+	agentId string,
+	inputs []string,
+) ([]agents.Detail, error) {
+	agentConfig := dagConfig.Agents[agentId]
+	details := []agents.Detail{{Name: "graph", Value: agentConfig.Graph}}
+	for _, name := range sortedKeys(agentConfig.Inputs) {
+		details = append(details, agents.Detail{Name: "input " + name, Value: inputText(agentConfig.Inputs[name])})
+	}
+	provided := make(map[string]*Result, len(agentConfig.Provide))
+	for _, nestedID := range sortedKeys(agentConfig.Provide) {
+		details = append(details, agents.Detail{Name: "provide " + nestedID, Value: agentConfig.Provide[nestedID]})
+		provided[nestedID] = &Result{}
+	}
+
+	if agentConfig.Subgraph != nil {
+		sub := NewDAG(agentConfig.Subgraph)
+		sub.Provided = provided
+		plan, err := sub.Plan()
+		if err != nil {
+			return nil, err
+		}
+		var nested strings.Builder
+		if err := plan.Write(&nested); err != nil {
+			return nil, err
+		}
+		details = append(details, agents.Detail{Name: "plan", Value: "\n" + nested.String()})
+	}
+	return details, nil
+}
+
+// subgraphPath resolves a subgraph reference relative to the file of the
+// graph that contains it.
+func subgraphPath(parent *config.DagConfig, graph string) string {
+	if filepath.IsAbs(graph) || parent.Path == "" {
+		return graph
+	}
+	return filepath.Join(filepath.Dir(parent.Path), graph)
+}
+
+// loadSubgraphs loads the graph file of every subgraph node of cfg, with
+// the node's `inputs:` as the values of the nested graph's inputs, and
+// checks the node's `provide:`. stack holds the files being loaded, cfg's own file
+// last, so that a file that ends up including itself is reported as a
+// cycle.
+func loadSubgraphs(cfg *config.DagConfig, stack []string) error {
+	for _, agentID := range sortedAgentIDs(cfg) {
+		agentConfig := cfg.Agents[agentID]
+		if agentConfig.Type != SubgraphType {
+			if agentConfig.Graph != "" || len(agentConfig.Inputs) > 0 || len(agentConfig.Provide) > 0 {
+				return fmt.Errorf("agent %q: graph, inputs and provide are only valid for %s nodes", agentID, SubgraphType)
+			}
+			continue
+		}
+		if agentConfig.Graph == "" {
+			return fmt.Errorf("agent %q: %s nodes need a graph file", agentID, SubgraphType)
+		}
+
+		path, err := filepath.Abs(subgraphPath(cfg, agentConfig.Graph))
+		if err != nil {
+			return err
+		}
+		for i, file := range stack {
+			if file == path {
+				return fmt.Errorf("agent %q: %w", agentID, &CycleError{Path: append(stack[i:len(stack):len(stack)], path)})
+			}
+		}
+		nested, err := loadDAGFile(path, agentConfig.Inputs, stack)
+		if err != nil {
+			return fmt.Errorf("agent %q: %s: %w", agentID, agentConfig.Graph, err)
+		}
+
+		for _, nestedID := range sortedKeys(agentConfig.Provide) {
+			if _, ok := nested.Agents[nestedID]; !ok {
+				return fmt.Errorf("agent %q: provide %q is not an agent of %s", agentID, nestedID, agentConfig.Graph)
+			}
+			if inputPath := agentConfig.Provide[nestedID]; !isInputSource(agentConfig, inputPath) {
+				return fmt.Errorf("agent %q: provide %q must start with one of its children", agentID, inputPath)
+			}
+		}
+
+		agentConfig.Subgraph = nested
+		cfg.Agents[agentID] = agentConfig
+	}
+	return nil
+}
+
+// isInputSource reports whether a dotted path starts with a value the node
+// receives: one of its children, or the element name of a map node.
+func isInputSource(agentConfig config.AgentConfig, path string) bool {
+	source, _, _ := strings.Cut(path, ".")
+	for _, childID := range agentConfig.Children {
+		if childID == source {
+			return true
+		}
+	}
+	if agentConfig.Map != nil {
+		itemName := agentConfig.Map.As
+		if itemName == "" {
+			itemName = defaultMapItemName
+		}
+		return source == itemName
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package dag
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const nestedGraph = `
+inputs:
+  symbol:
+    type: string
+  limit:
+    type: integer
+    default: 10
+agents:
+  mentions:
+    type: fetchCryptoMentions
+    when: "{{ .inputs.symbol }}"
+`
+
+func TestLoadSubgraphInputs(t *testing.T) {
+	tests := []struct {
+		name string
+		node string
+		want map[string]interface{}
+		err  string
+	}{
+		{
+			name: "inputs set",
+			node: "inputs: {symbol: BTC, limit: 3}",
+			want: map[string]interface{}{"symbol": "BTC", "limit": 3},
+		},
+		{
+			name: "default used",
+			node: "inputs: {symbol: ETH}",
+			want: map[string]interface{}{"symbol": "ETH", "limit": 10},
+		},
+		{
+			name: "required input missing",
+			node: "",
+			err:  "input symbol has no default and no value was given",
+		},
+		{
+			name: "unknown input",
+			node: "inputs: {symbol: BTC, coin: SOL}",
+			err:  `unknown input "coin"`,
+		},
+		{
+			name: "wrong type",
+			node: "inputs: {symbol: BTC, limit: many}",
+			err:  "input limit: expected integer, got a string",
+		},
+		{
+			name: "provide names a nested node",
+			node: "inputs: {symbol: BTC}\n    children: [source]\n    provide: {mentions: source}",
+			want: map[string]interface{}{"symbol": "BTC", "limit": 10},
+		},
+		{
+			name: "provide names an unknown node",
+			node: "inputs: {symbol: BTC}\n    children: [source]\n    provide: {missing: source}",
+			err:  `provide "missing" is not an agent of nested.yaml`,
+		},
+		{
+			name: "provide outside the children",
+			node: "inputs: {symbol: BTC}\n    provide: {mentions: elsewhere.value}",
+			err:  `provide "elsewhere.value" must start with one of its children`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			parent := "agents:\n  source:\n    type: fetchCryptoMentions\n  sub:\n    type: subgraph\n    graph: nested.yaml\n    " + test.node + "\n"
+			writeFile(t, filepath.Join(dir, "nested.yaml"), nestedGraph)
+			writeFile(t, filepath.Join(dir, "graph.yaml"), parent)
+
+			cfg, err := LoadDAG(filepath.Join(dir, "graph.yaml"))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadDAG: %v", err)
+			}
+			nested := cfg.Agents["sub"].Subgraph
+			for name, want := range test.want {
+				if got := nested.InputValues[name]; got != want {
+					t.Errorf("input %s = %#v, want %#v", name, got, want)
+				}
+			}
+			if got := nested.Agents["mentions"].When; got != test.want["symbol"] {
+				t.Errorf("when = %q, want the symbol input", got)
+			}
+		})
+	}
+}
+
+func TestProvideOnlyForSubgraphNodes(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "graph.yaml"), "agents:\n  a:\n    type: fetchCryptoMentions\n    provide: {x: y}\n")
+	_, err := LoadDAG(filepath.Join(dir, "graph.yaml"))
+	if err == nil || !strings.Contains(err.Error(), "graph, inputs and provide are only valid for subgraph nodes") {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,612 @@
+package dag
+
+import (
+	"ai-dag/agents"
+	"ai-dag/config"
+	"ai-dag/secrets"
+	"bytes"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Problem is a mistake found in a graph file by Validate.
+type Problem struct {
+	File string
+	// Line is 1-based; zero when the problem is not tied to a line.
+	Line    int
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("%s: %s", p.File, p.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+}
+
+// Validate checks the graph file at path, and the graph files of its
+// subgraph nodes, more strictly than LoadDAG: fields unknown to
+// config.AgentConfig, IDs that disagree with their keys, missing children,
+// unregistered agent types, fields required by an agent type and template
+// references to values the node does not receive are all reported. Every
+// problem found is returned, sorted by file and line; the error is only set
+// if the file can't be read.
+func Validate(path string) ([]Problem, error) {
+	v := &validator{
+		registry:  agents.DefaultRegistry,
+		validated: make(map[string]*config.DagConfig),
+	}
+	if _, err := v.validate(path, nil); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(v.problems, func(i, j int) bool {
+		if v.problems[i].File != v.problems[j].File {
+			return v.problems[i].File < v.problems[j].File
+		}
+		return v.problems[i].Line < v.problems[j].Line
+	})
+	return v.problems, nil
+}
+
+type validator struct {
+	registry *agents.Registry
+	problems []Problem
+	// validated holds the graphs already checked, by absolute path, so
+	// that a file used by several subgraph nodes is reported once
+	validated map[string]*config.DagConfig
+}
+
+// graphFile is a graph being validated along with its YAML tree, used to
+// find the line of each setting.
+type graphFile struct {
+	name   string
+	cfg    *config.DagConfig
+	agents *yaml.Node
+	root   *yaml.Node
+}
+
+func (f *graphFile) agentLine(agentID string) int {
+	key, _ := mappingEntry(f.agents, agentID)
+	return line(key)
+}
+
+// fieldLine returns the line of a dotted field of a node, or the line of
+// the node itself if the field is not set.
+func (f *graphFile) fieldLine(agentID string, field string) int {
+	_, node := mappingEntry(f.agents, agentID)
+	if _, value := lookupNode(node, field); value != nil {
+		return value.Line
+	}
+	return f.agentLine(agentID)
+}
+
+// validate checks one graph file. stack holds the absolute paths of the
+// files that include it, to report files that include themselves.
+func (v *validator) validate(path string, stack []string) (*config.DagConfig, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if cfg, ok := v.validated[absPath]; ok {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		return nil, err
+	}
+	v.validated[absPath] = nil
+
+	format := config.FormatOf(absPath)
+	if format == "" {
+		format = config.DetectFormat(data)
+	}
+	root, err := config.ParseDocument(data, format)
+	if err != nil {
+		v.addYAMLError(path, err)
+		return nil, nil
+	}
+	// Unknown fields are found by decoding the document strictly, which
+	// only the YAML decoder does. JSON files are decoded as written, with
+	// their line numbers, unless the YAML parser can't read them
+	strictData, hasLines := data, format == config.FormatYAML
+	if format == config.FormatJSON {
+		hasLines = yaml.Unmarshal(data, &yaml.Node{}) == nil
+	}
+	if !hasLines {
+		if strictData, err = yaml.Marshal(root); err != nil {
+			return nil, err
+		}
+	}
+	for _, err := range config.Interpolate(root, os.LookupEnv) {
+		v.add(path, err.Line, err.Message)
+	}
+	if len(root.Content) > 0 {
+		inputs, values := v.checkInputs(path, root)
+		for _, err := range substituteInputs(root.Content[0], inputs, values) {
+			v.add(path, err.Line, err.Message)
+		}
+	}
+	cfg := &config.DagConfig{}
+	if len(root.Content) > 0 {
+		if err := root.Decode(cfg); err != nil {
+			v.addYAMLError(path, err)
+		}
+	}
+	v.checkUnknownFields(path, strictData, hasLines)
+	cfg.Path = absPath
+	v.validated[absPath] = cfg
+
+	file := &graphFile{name: path, cfg: cfg}
+	if len(root.Content) > 0 {
+		file.root = root.Content[0]
+		_, file.agents = mappingEntry(file.root, "agents")
+	}
+	if len(cfg.Agents) == 0 {
+		v.add(file.name, line(file.root), "no agents defined")
+	}
+
+	childrenOK := true
+	for _, agentID := range sortedAgentIDs(cfg) {
+		childrenOK = v.checkAgent(file, agentID) && childrenOK
+		v.checkTemplates(file, agentID)
+		if cfg.Agents[agentID].Type == SubgraphType {
+			v.checkSubgraph(file, agentID, append(stack, absPath))
+		}
+	}
+	if childrenOK {
+		_, err := NewDAG(cfg).topologicalSort()
+		var cycle *CycleError
+		if errors.As(err, &cycle) {
+			v.add(file.name, file.agentLine(cycle.Path[0]), err.Error())
+		}
+	}
+	v.checkGraphSettings(file)
+	return cfg, nil
+}
+
+// checkAgent checks the settings of one node and reports whether all its
+// children are defined.
+func (v *validator) checkAgent(file *graphFile, agentID string) bool {
+	agentConfig := file.cfg.Agents[agentID]
+	prefix := fmt.Sprintf("agent %q: ", agentID)
+
+	if agentConfig.ID != "" && agentConfig.ID != agentID {
+		v.add(file.name, file.fieldLine(agentID, "id"), prefix+fmt.Sprintf("id %q does not match its key", agentConfig.ID))
+	}
+
+	childrenOK := true
+	_, node := mappingEntry(file.agents, agentID)
+	_, children := mappingEntry(node, "children")
+	for i, childID := range agentConfig.Children {
+		if _, ok := file.cfg.Agents[childID]; ok {
+			continue
+		}
+		childrenOK = false
+		childLine := file.agentLine(agentID)
+		if children != nil && i < len(children.Content) {
+			childLine = children.Content[i].Line
+		}
+		v.add(file.name, childLine, prefix+fmt.Sprintf("child %q is not a defined agent", childID))
+	}
+
+	switch {
+	case agentConfig.Type == "":
+		v.add(file.name, file.agentLine(agentID), prefix+"missing type")
+	case !v.registry.Has(agentConfig.Type):
+		v.add(file.name, file.fieldLine(agentID, "type"), prefix+fmt.Sprintf(
+			"unknown type %q (known types: %s)",
+			agentConfig.Type,
+			strings.Join(v.registry.Types(), ", "),
+		))
+	default:
+		for _, field := range v.registry.Required(agentConfig.Type) {
+			if _, value := lookupNode(node, field); value == nil || isEmptyNode(value) {
+				v.add(file.name, file.agentLine(agentID), prefix+fmt.Sprintf("%s nodes need %s", agentConfig.Type, field))
+			}
+		}
+		v.checkParams(file, agentID)
+	}
+
+	single := &config.DagConfig{
+		Path:   file.cfg.Path,
+		Agents: map[string]config.AgentConfig{agentID: agentConfig},
+	}
+	if err := checkConditions(single); err != nil {
+		v.add(file.name, file.fieldLine(agentID, "when"), err.Error())
+	}
+	if err := checkMaps(single); err != nil {
+		v.add(file.name, file.fieldLine(agentID, "map"), err.Error())
+	}
+	if agentConfig.Type != SubgraphType && (agentConfig.Graph != "" || len(agentConfig.Inputs) > 0 || len(agentConfig.Provide) > 0) {
+		v.add(file.name, file.agentLine(agentID), prefix+fmt.Sprintf("graph, inputs and provide are only valid for %s nodes", SubgraphType))
+	}
+	return childrenOK
+}
+
+// checkParams checks the params of a node against the schema of its agent
+// type.
+func (v *validator) checkParams(file *graphFile, agentID string) {
+	agentConfig := file.cfg.Agents[agentID]
+	prefix := fmt.Sprintf("agent %q: ", agentID)
+	schema := v.registry.Params(agentConfig.Type)
+	if schema == nil {
+		if len(agentConfig.Params) > 0 {
+			v.add(file.name, file.fieldLine(agentID, "params"), prefix+fmt.Sprintf("%s nodes take no params", agentConfig.Type))
+		}
+		return
+	}
+	_, errs := schema.Apply(agentConfig.Params)
+	for _, err := range errs {
+		v.add(file.name, file.fieldLine(agentID, "params."+err.Path), prefix+err.Error())
+	}
+}
+
+// checkSubgraph validates the graph file of a subgraph node and the inputs
+// and results the node supplies to it.
+func (v *validator) checkSubgraph(file *graphFile, agentID string, stack []string) {
+	agentConfig := file.cfg.Agents[agentID]
+	prefix := fmt.Sprintf("agent %q: ", agentID)
+	if agentConfig.Graph == "" {
+		return
+	}
+	nestedPath := agentConfig.Graph
+	if !filepath.IsAbs(nestedPath) {
+		nestedPath = filepath.Join(filepath.Dir(file.name), nestedPath)
+	}
+	absPath, err := filepath.Abs(nestedPath)
+	if err != nil {
+		v.add(file.name, file.fieldLine(agentID, "graph"), prefix+err.Error())
+		return
+	}
+	for i, stackPath := range stack {
+		if stackPath == absPath {
+			cycle := &CycleError{Path: append(stack[i:len(stack):len(stack)], absPath)}
+			v.add(file.name, file.fieldLine(agentID, "graph"), prefix+cycle.Error())
+			return
+		}
+	}
+	nested, err := v.validate(nestedPath, stack)
+	if err != nil {
+		v.add(file.name, file.fieldLine(agentID, "graph"), prefix+err.Error())
+		return
+	}
+	if nested == nil {
+		return
+	}
+	if _, err := resolveInputs(nested.Inputs, agentConfig.Inputs); err != nil {
+		v.add(file.name, file.fieldLine(agentID, "inputs"), prefix+fmt.Sprintf("%s: %s", agentConfig.Graph, err))
+	}
+	for _, nestedID := range sortedKeys(agentConfig.Provide) {
+		provideLine := file.fieldLine(agentID, "provide."+nestedID)
+		if _, ok := nested.Agents[nestedID]; !ok {
+			v.add(file.name, provideLine, prefix+fmt.Sprintf("provide %q is not an agent of %s", nestedID, agentConfig.Graph))
+		}
+		if inputPath := agentConfig.Provide[nestedID]; !isInputSource(agentConfig, inputPath) {
+			v.add(file.name, provideLine, prefix+fmt.Sprintf("provide %q must start with one of its children", inputPath))
+		}
+	}
+}
+
+// checkGraphSettings checks the top-level settings that name nodes or agent
+// types.
+func (v *validator) checkGraphSettings(file *graphFile) {
+	_, outputs := mappingEntry(file.root, "outputs")
+	for i, agentID := range file.cfg.Outputs {
+		if _, ok := file.cfg.Agents[agentID]; ok {
+			continue
+		}
+		outputLine := line(outputs)
+		if outputs != nil && i < len(outputs.Content) {
+			outputLine = outputs.Content[i].Line
+		}
+		v.add(file.name, outputLine, fmt.Sprintf("output %q is not a defined agent", agentID))
+	}
+
+	_, sources := mappingEntry(file.root, "secrets")
+	for i, source := range file.cfg.Secrets {
+		if err := secrets.Check(source); err != nil {
+			sourceLine := line(sources)
+			if sources != nil && i < len(sources.Content) {
+				sourceLine = sources.Content[i].Line
+			}
+			v.add(file.name, sourceLine, fmt.Sprintf("secrets[%d]: %s", i, err))
+		}
+	}
+
+	global := &config.DagConfig{MaxConcurrency: file.cfg.MaxConcurrency}
+	if err := checkConcurrency(global, v.registry.Has); err != nil {
+		_, value := mappingEntry(file.root, "maxConcurrency")
+		v.add(file.name, line(value), err.Error())
+	}
+	_, concurrency := mappingEntry(file.root, "concurrency")
+	for _, agentType := range sortedKeys(file.cfg.Concurrency) {
+		single := &config.DagConfig{Concurrency: map[string]int{agentType: file.cfg.Concurrency[agentType]}}
+		if err := checkConcurrency(single, v.registry.Has); err != nil {
+			key, _ := mappingEntry(concurrency, agentType)
+			v.add(file.name, line(key), err.Error())
+		}
+	}
+}
+
+// checkTemplates makes sure the templates of a node only refer to values
+// it receives: its children and, for map nodes, the element name.
+func (v *validator) checkTemplates(file *graphFile, agentID string) {
+	agentConfig := file.cfg.Agents[agentID]
+	known := make(map[string]bool, len(agentConfig.Children)+1)
+	for _, childID := range agentConfig.Children {
+		known[childID] = true
+	}
+	if agentConfig.Map != nil {
+		itemName := agentConfig.Map.As
+		if itemName == "" {
+			itemName = defaultMapItemName
+		}
+		known[itemName] = true
+	}
+
+	_, node := mappingEntry(file.agents, agentID)
+	check := func(field string, text string, value *yaml.Node) {
+		if text == "" {
+			return
+		}
+		tmpl, err := template.New(agentID).Parse(text)
+		if err != nil {
+			// Broken `when:` conditions are reported by checkConditions
+			if field != "when" {
+				v.add(file.name, line(value), fmt.Sprintf("agent %q: invalid %s template: %v", agentID, field, err))
+			}
+			return
+		}
+		for _, ref := range templateRefs(tmpl.Tree.Root, true) {
+			if known[ref.name] {
+				continue
+			}
+			v.add(file.name, templateLine(value, text, ref.pos), fmt.Sprintf(
+				"agent %q: %s refers to {{.%s}}, which is not one of its children",
+				agentID, field, ref.name,
+			))
+		}
+	}
+
+	_, params := mappingEntry(node, "params")
+	_, messages := mappingEntry(params, "messages")
+	messageList, _ := agentConfig.Params["messages"].([]interface{})
+	for i, message := range messageList {
+		fields, _ := message.(map[string]interface{})
+		text, _ := fields["content"].(string)
+		var content *yaml.Node
+		if messages != nil && i < len(messages.Content) {
+			_, content = mappingEntry(messages.Content[i], "content")
+		}
+		check("params.messages["+strconv.Itoa(i)+"].content", text, content)
+	}
+	_, promptTemplate := mappingEntry(node, "promptTemplate")
+	check("promptTemplate", agentConfig.PromptTemplate, promptTemplate)
+	_, when := mappingEntry(node, "when")
+	check("when", agentConfig.When, when)
+}
+
+// templateRef is a top-level value a template refers to, such as
+// weatherForecast in {{.weatherForecast.current}}.
+type templateRef struct {
+	name string
+	pos  parse.Pos
+}
+
+// templateRefs collects the top-level values a template refers to. dot
+// reports whether "." is still the template's data at this point; inside
+// range and with blocks it is not, so only $.name references count there.
+func templateRefs(node parse.Node, dot bool) []templateRef {
+	var refs []templateRef
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			refs = append(refs, templateRefs(child, dot)...)
+		}
+	case *parse.ActionNode:
+		refs = templateRefs(n.Pipe, dot)
+	case *parse.TemplateNode:
+		refs = templateRefs(n.Pipe, dot)
+	case *parse.PipeNode:
+		if n == nil {
+			return nil
+		}
+		for _, cmd := range n.Cmds {
+			refs = append(refs, templateRefs(cmd, dot)...)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			refs = append(refs, templateRefs(arg, dot)...)
+		}
+	case *parse.ChainNode:
+		refs = templateRefs(n.Node, dot)
+	case *parse.FieldNode:
+		if dot {
+			refs = append(refs, templateRef{name: n.Ident[0], pos: n.Pos})
+		}
+	case *parse.VariableNode:
+		if n.Ident[0] == "$" && len(n.Ident) > 1 {
+			refs = append(refs, templateRef{name: n.Ident[1], pos: n.Pos})
+		}
+	case *parse.IfNode:
+		refs = branchRefs(&n.BranchNode, dot, dot)
+	case *parse.RangeNode:
+		refs = branchRefs(&n.BranchNode, dot, false)
+	case *parse.WithNode:
+		refs = branchRefs(&n.BranchNode, dot, false)
+	}
+	return refs
+}
+
+func branchRefs(n *parse.BranchNode, dot bool, bodyDot bool) []templateRef {
+	refs := templateRefs(n.Pipe, dot)
+	refs = append(refs, templateRefs(n.List, bodyDot)...)
+	return append(refs, templateRefs(n.ElseList, dot)...)
+}
+
+// templateLine returns the file line of the given offset into a template
+// held by a YAML scalar. Block scalars start on the line after their key.
+func templateLine(value *yaml.Node, text string, pos parse.Pos) int {
+	if value == nil {
+		return 0
+	}
+	start := value.Line
+	if value.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+		start++
+	}
+	if int(pos) > len(text) {
+		return start
+	}
+	return start + strings.Count(text[:pos], "\n")
+}
+
+// yamlLinePattern matches the line number yaml.v3, and the TOML parser,
+// put in their messages.
+var yamlLinePattern = regexp.MustCompile(`^(?:yaml: |toml: )?line (\d+)(?: \([^)]*\))?: (.*)$`)
+
+// unknownFieldPattern matches the error yaml.v3 reports for fields the
+// target struct does not have.
+var unknownFieldPattern = regexp.MustCompile(`^field (\S+) not found in type \S+$`)
+
+// addYAMLError reports a decoding error, one problem per message when
+// yaml.v3 collected several.
+func (v *validator) addYAMLError(file string, err error) {
+	messages := []string{err.Error()}
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	}
+	for _, message := range messages {
+		errLine := 0
+		if match := yamlLinePattern.FindStringSubmatch(message); match != nil {
+			errLine, _ = strconv.Atoi(match[1])
+			message = match[2]
+		}
+		if match := unknownFieldPattern.FindStringSubmatch(message); match != nil {
+			message = fmt.Sprintf("unknown field %q", match[1])
+		}
+		v.add(file, errLine, message)
+	}
+}
+
+// checkInputs checks the declarations of a graph's inputs and returns
+// them along with the values templates are checked with: the defaults,
+// or a zero value for inputs without one.
+func (v *validator) checkInputs(file string, root *yaml.Node) (map[string]config.InputConfig, map[string]interface{}) {
+	inputs, err := declaredInputs(root)
+	if err != nil {
+		// Reported when the whole file is decoded
+		return nil, nil
+	}
+	_, inputsNode := mappingEntry(root.Content[0], "inputs")
+	values := make(map[string]interface{}, len(inputs))
+	for _, name := range sortedKeys(inputs) {
+		schema, err := inputSchema(map[string]config.InputConfig{name: inputs[name]})
+		if err != nil {
+			key, _ := mappingEntry(inputsNode, name)
+			v.add(file, line(key), err.Error())
+			continue
+		}
+		param := schema.Params[0]
+		values[name] = param.Default
+		if param.Default == nil {
+			values[name] = zeroInput(param.Type)
+		}
+	}
+	return inputs, values
+}
+
+// checkUnknownFields reports fields unknown to config.DagConfig. A decoded
+// yaml.Node can't reject them, so the document as written is decoded
+// again, strictly, keeping only those errors. hasLines is false when data
+// is not the file itself, whose line numbers are then meaningless.
+func (v *validator) checkUnknownFields(file string, data []byte, hasLines bool) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	var typeErr *yaml.TypeError
+	if err := decoder.Decode(&config.DagConfig{}); !errors.As(err, &typeErr) {
+		return
+	}
+	var unknown []string
+	for _, message := range typeErr.Errors {
+		if match := yamlLinePattern.FindStringSubmatch(message); match != nil && unknownFieldPattern.MatchString(match[2]) {
+			if !hasLines {
+				message = match[2]
+			}
+			unknown = append(unknown, message)
+		}
+	}
+	if len(unknown) > 0 {
+		v.addYAMLError(file, &yaml.TypeError{Errors: unknown})
+	}
+}
+
+func (v *validator) add(file string, line int, message string) {
+	v.problems = append(v.problems, Problem{File: file, Line: line, Message: message})
+}
+
+// mappingEntry returns the key and value nodes of key in a YAML mapping,
+// or nils if node is not a mapping or does not have the key.
+func mappingEntry(node *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i], node.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// lookupNode follows a dotted path of mapping keys, such as
+// "payload.location", from node.
+func lookupNode(node *yaml.Node, path string) (*yaml.Node, *yaml.Node) {
+	var key *yaml.Node
+	for _, segment := range strings.Split(path, ".") {
+		key, node = mappingEntry(node, segment)
+		if node == nil {
+			return nil, nil
+		}
+	}
+	return key, node
+}
+
+// isEmptyNode reports whether a YAML value is null or empty.
+func isEmptyNode(node *yaml.Node) bool {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return node.Tag == "!!null" || (node.Tag == "!!str" && node.Value == "")
+	case yaml.MappingNode, yaml.SequenceNode:
+		return len(node.Content) == 0
+	}
+	return false
+}
+
+func line(node *yaml.Node) int {
+	if node == nil {
+		return 0
+	}
+	return node.Line
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
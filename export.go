@@ -0,0 +1,55 @@
+package main
+
+import (
+	"ai-dag/config"
+	"ai-dag/dag"
+	"flag"
+	"fmt"
+	"os"
+)
+
+func exportCommand(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	graphFile := flags.String("graph", "graph.yaml", "path to the graph definition, - for standard input")
+	formatName := flags.String("format", string(config.FormatYAML), "format to write: yaml, json or toml")
+	output := flags.String("o", "", "file to write, standard output by default")
+	var inputs inputOptions
+	inputs.register(flags)
+	_ = flags.Parse(args)
+
+	format, err := config.ParseFormat(*formatName)
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+	values, err := inputs.values()
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+	var cfg *config.DagConfig
+	if *graphFile == "-" {
+		cfg, err = dag.LoadDAGFromReader(os.Stdin, "", values)
+	} else {
+		cfg, err = dag.LoadDAGWithInputs(*graphFile, values)
+	}
+	if err != nil {
+		fmt.Println("Failed to load graph:", err)
+		return 1
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		out, err = os.Create(*output)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		defer out.Close()
+	}
+	if err := config.Export(out, cfg, format); err != nil {
+		fmt.Println("Failed to export graph:", err)
+		return 1
+	}
+	return 0
+}
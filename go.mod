@@ -3,3 +3,5 @@ module ai-dag
 go 1.21.3
 
 require gopkg.in/yaml.v3 v3.0.1
+
+require github.com/BurntSushi/toml v1.5.0
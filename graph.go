@@ -0,0 +1,71 @@
+package main
+
+import (
+	"ai-dag/dag"
+	"flag"
+	"fmt"
+	"os"
+)
+
+func graphCommand(args []string) int {
+	flags := flag.NewFlagSet("graph", flag.ExitOnError)
+	graphFile := flags.String("graph", "graph.yaml", "path to the graph definition")
+	format := flags.String("format", dag.FormatDOT, "diagram format: dot or mermaid")
+	runId := flags.String("run", "", "overlay the status and duration of each node in this run; \"latest\" for the latest run of the graph")
+	runsDir := flags.String("runs-dir", dag.DefaultRunsDir, "directory holding run checkpoints")
+	var inputs inputOptions
+	inputs.register(flags)
+	_ = flags.Parse(args)
+
+	values, err := inputs.values()
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+	var summaries map[string]dag.NodeSummary
+	if *runId != "" {
+		var checkpoint *dag.Checkpoint
+		if *runId == "latest" {
+			checkpoint, err = dag.LatestCheckpoint(*runsDir, *graphFile)
+			if err == nil && checkpoint == nil {
+				err = fmt.Errorf("no run of %s in %s", *graphFile, *runsDir)
+			}
+		} else {
+			checkpoint, err = dag.OpenCheckpoint(*runsDir, *runId)
+		}
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		// Draw the graph the run was made from unless told otherwise
+		graphSet := false
+		flags.Visit(func(f *flag.Flag) {
+			graphSet = graphSet || f.Name == "graph"
+		})
+		if !graphSet {
+			*graphFile = checkpoint.Graph
+		}
+		// Use the input values of the run unless given others
+		for name, value := range checkpoint.Inputs {
+			if _, ok := values[name]; !ok {
+				values[name] = value
+			}
+		}
+		summaries, err = checkpoint.Summaries()
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+	}
+
+	cfg, err := dag.LoadDAGWithInputs(*graphFile, values)
+	if err != nil {
+		fmt.Println("Failed to load graph:", err)
+		return 1
+	}
+	if err := dag.WriteDiagram(os.Stdout, cfg, *format, summaries); err != nil {
+		fmt.Println(err)
+		return 2
+	}
+	return 0
+}
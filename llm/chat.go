@@ -2,6 +2,9 @@ package llm
 
 import (
 	"ai-dag/config"
+	"ai-dag/metrics"
+	"ai-dag/tracing"
+	"ai-dag/utils"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -23,14 +26,23 @@ type ChatCompletionResponse struct {
 		LogProbs     interface{}    `json:"logprobs"`
 		FinishReason string         `json:"finish_reason"`
 	} `json:"choices"`
-	Usage struct {
-		PromptTokens     int `json:"prompt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
-	} `json:"usage"`
+	Usage             Usage  `json:"usage"`
 	SystemFingerprint string `json:"system_fingerprint"`
 }
 
+// Usage reports the tokens consumed by a chat completion
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+var tokensTotal = metrics.NewCounter(
+	"ai_dag_llm_tokens_total",
+	"Tokens consumed by LLM calls, by model and kind (prompt or completion).",
+	"model", "kind",
+)
+
 // GPTChat to encapsulate llm interactions
 type GPTChat struct {
 	APIKey   string
@@ -40,19 +52,43 @@ type GPTChat struct {
 }
 
 func (g *GPTChat) Execute(ctx context.Context, input interface{}) (interface{}, error) {
-	result, err := g.execute()
+	result, _, err := g.Complete(ctx)
 	if err != nil {
 		return nil, err
 	}
 	return result, nil
 }
 
+// Complete sends the conversation and returns the llm's response together
+// with the tokens it consumed.
+func (g *GPTChat) Complete(ctx context.Context) (content string, usage Usage, err error) {
+	ctx, span := tracing.Start(ctx, "chat "+g.Config.Chat.Model, tracing.KindInternal)
+	span.SetAttribute("gen_ai.request.model", g.Config.Chat.Model)
+	defer func() {
+		span.SetAttribute("gen_ai.usage.input_tokens", usage.PromptTokens)
+		span.SetAttribute("gen_ai.usage.output_tokens", usage.CompletionTokens)
+		tokensTotal.Add(float64(usage.PromptTokens), g.Config.Chat.Model, "prompt")
+		tokensTotal.Add(float64(usage.CompletionTokens), g.Config.Chat.Model, "completion")
+		span.SetError(err)
+		span.Finish()
+	}()
+
+	response, err := g.execute(ctx)
+	if err != nil {
+		return "", Usage{}, err
+	}
+	if len(response.Choices) > 0 {
+		return response.Choices[0].Message.Content, response.Usage, nil
+	}
+	return "", response.Usage, fmt.Errorf("no response from OpenAI")
+}
+
 // NewGPTChat creates a new instance of GPTChat with initialized values.
 func NewGPTChat(apiKey string, cfg *config.Config) *GPTChat {
 	return &GPTChat{
 		APIKey:   apiKey,
 		Messages: cfg.Chat.Messages,
-		Client:   &http.Client{},
+		Client:   utils.HTTPClient,
 		Config:   cfg,
 	}
 }
@@ -62,31 +98,32 @@ func (g *GPTChat) AddMessage(role, content string) {
 	g.Messages = append(g.Messages, config.Message{Role: role, Content: content})
 }
 
-// Execute sends the conversation to OpenAI's API and returns the llm's response.
-func (g *GPTChat) execute() (string, error) {
+// execute sends the conversation to OpenAI's API and returns the decoded response.
+func (g *GPTChat) execute(ctx context.Context) (*ChatCompletionResponse, error) {
 	requestData := map[string]interface{}{
 		"model":    g.Config.Chat.Model,
 		"messages": g.Messages,
 	}
 	requestBody, err := json.Marshal(requestData)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		ctx,
 		g.Config.Chat.RequestMethod,
 		g.Config.Chat.RequestURL,
 		bytes.NewBuffer(requestBody),
 	)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	req.Header.Add("Authorization", "Bearer "+g.APIKey)
 	req.Header.Add("Content-Type", "application/json")
 
 	resp, err := g.Client.Do(req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
@@ -97,18 +134,16 @@ func (g *GPTChat) execute() (string, error) {
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if err := utils.CheckResponse(resp, body); err != nil {
+		return nil, err
 	}
 
 	var response ChatCompletionResponse
 	err = json.Unmarshal(body, &response)
 	if err != nil {
-		return "", err
-	}
-
-	if len(response.Choices) > 0 {
-		return response.Choices[0].Message.Content, nil
+		return nil, err
 	}
-
-	return "", fmt.Errorf("no response from OpenAI")
+	return &response, nil
 }
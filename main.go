@@ -1,16 +1,46 @@
 package main
 
 import (
-	"ai-dag/dag"
+	"fmt"
+	"os"
+	"strings"
 )
 
+const usage = `Usage:
+  ai-dag [run] [flags]           run a graph, or part of it
+  ai-dag resume [flags] <run-id> resume a failed run
+  ai-dag plan [flags]            show what a run would do, without running it
+  ai-dag validate [flags]        check a graph file for mistakes
+  ai-dag graph [flags]           draw a graph as a DOT or Mermaid diagram
+  ai-dag export [flags]          write a graph as YAML, JSON or TOML
+
+Run "ai-dag <command> -h" for the flags of a command.
+`
+
 func main() {
-	config, err := dag.LoadDAGFromYAML("graph.yaml")
-	if err != nil {
-		panic(err)
+	args := os.Args[1:]
+	command := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
 	}
 
-	// Load dGraph into registry
-	dGraph := dag.NewDAG(config)
-	dGraph.Execute()
+	switch command {
+	case "run":
+		os.Exit(runCommand(args))
+	case "resume":
+		os.Exit(resumeCommand(args))
+	case "plan":
+		os.Exit(planCommand(args))
+	case "validate":
+		os.Exit(validateCommand(args))
+	case "graph":
+		os.Exit(graphCommand(args))
+	case "export":
+		os.Exit(exportCommand(args))
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
 }
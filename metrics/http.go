@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+)
+
+var httpResponses = NewCounter(
+	"ai_dag_http_responses_total",
+	"Outbound HTTP requests made by agents, by host and status code; code is \"error\" when no response was received.",
+	"host", "code",
+)
+
+// Transport wraps an http.RoundTripper so that the status code of every
+// response is counted.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return &transport{base: base}
+}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	httpResponses.Inc(req.URL.Hostname(), code)
+	return resp, err
+}
+
+// Handler serves the metrics of the registry in the Prometheus text format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = r.WriteText(w)
+	})
+}
+
+// Serve exposes the DefaultRegistry on /metrics at addr, in the background.
+// It returns once the listener is open.
+func Serve(addr string) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", DefaultRegistry.Handler())
+	server := &http.Server{Handler: mux}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	return server, nil
+}
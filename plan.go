@@ -0,0 +1,37 @@
+package main
+
+import (
+	"ai-dag/dag"
+	"flag"
+	"fmt"
+	"os"
+)
+
+func planCommand(args []string) int {
+	flags := flag.NewFlagSet("plan", flag.ExitOnError)
+	graphFile := flags.String("graph", "graph.yaml", "path to the graph definition")
+	var inputs inputOptions
+	inputs.register(flags)
+	_ = flags.Parse(args)
+
+	values, err := inputs.values()
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+	cfg, err := dag.LoadDAGWithInputs(*graphFile, values)
+	if err != nil {
+		fmt.Println("Failed to load graph:", err)
+		return 1
+	}
+	plan, err := dag.NewDAG(cfg).Plan()
+	if err != nil {
+		fmt.Println("Failed to plan graph:", err)
+		return 1
+	}
+	if err := plan.Write(os.Stdout); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"ai-dag/agents"
+	"ai-dag/config"
+	"ai-dag/dag"
+	"ai-dag/metrics"
+	"ai-dag/tracing"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// concurrencyFlag collects repeated -concurrency type=N flags.
+type concurrencyFlag map[string]int
+
+func (c concurrencyFlag) String() string {
+	pairs := make([]string, 0, len(c))
+	for agentType, limit := range c {
+		pairs = append(pairs, fmt.Sprintf("%s=%d", agentType, limit))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (c concurrencyFlag) Set(value string) error {
+	agentType, limitStr, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("expected type=N, got %q", value)
+	}
+	if !agents.DefaultRegistry.Has(agentType) {
+		return fmt.Errorf("unknown agent type %q", agentType)
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit < 0 {
+		return fmt.Errorf("invalid limit %q for %s", limitStr, agentType)
+	}
+	c[agentType] = limit
+	return nil
+}
+
+// stringsFlag collects a flag that may be repeated.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// inputOptions are the flags that give values to a graph's inputs.
+type inputOptions struct {
+	set  stringsFlag
+	file string
+}
+
+func (o *inputOptions) register(flags *flag.FlagSet) {
+	flags.Var(&o.set, "set", "give the graph input name a value as name=value; may be repeated")
+	flags.StringVar(&o.file, "inputs", "", "JSON file of graph input values, overridden by -set")
+}
+
+// values returns the input values given on the command line.
+func (o *inputOptions) values() (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	if o.file != "" {
+		data, err := os.ReadFile(o.file)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &values); err != nil {
+			return nil, fmt.Errorf("%s: %w", o.file, err)
+		}
+	}
+	for _, pair := range o.set {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("-set: expected name=value, got %q", pair)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// runOptions are the flags shared by the commands that execute a graph.
+type runOptions struct {
+	maxConcurrency int
+	concurrency    concurrencyFlag
+	noCache        bool
+	cacheDir       string
+	runsDir        string
+	quiet          bool
+	eventsFile     string
+	traceFile      string
+	metricsAddr    string
+	metricsLinger  time.Duration
+}
+
+func (o *runOptions) register(flags *flag.FlagSet) {
+	flags.IntVar(&o.maxConcurrency, "max-concurrency", 0, "maximum number of agents running at once, overrides maxConcurrency in the graph (0 = no limit)")
+	o.concurrency = concurrencyFlag{}
+	flags.Var(o.concurrency, "concurrency", "per agent type limit as type=N, overrides concurrency in the graph; may be repeated")
+	flags.BoolVar(&o.noCache, "no-cache", false, "ignore and don't update cached node outputs")
+	flags.StringVar(&o.cacheDir, "cache-dir", dag.DefaultCacheDir, "directory for cached node outputs")
+	flags.StringVar(&o.runsDir, "runs-dir", dag.DefaultRunsDir, "directory for run checkpoints")
+	flags.BoolVar(&o.quiet, "quiet", false, "don't print the progress of each node")
+	flags.StringVar(&o.eventsFile, "events", "", "append every run and node event to this file as JSON lines")
+	flags.StringVar(&o.metricsAddr, "metrics-addr", "", "serve Prometheus metrics on /metrics at this address, e.g. :9090, while the run lasts")
+	flags.DurationVar(&o.metricsLinger, "metrics-linger", 0, "with -metrics-addr, keep serving metrics this long after the run, e.g. 1m, so that its outcome is scraped; an interrupt stops early")
+	flags.StringVar(&o.traceFile, "trace", "", "write spans for the run, its nodes and their HTTP requests to this file as OTLP JSON")
+}
+
+// apply overrides the graph's settings with the ones given on the command
+// line.
+func (o *runOptions) apply(flags *flag.FlagSet, cfg *config.DagConfig) error {
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "max-concurrency" {
+			cfg.MaxConcurrency = o.maxConcurrency
+		}
+	})
+	if cfg.MaxConcurrency < 0 {
+		return fmt.Errorf("-max-concurrency must not be negative")
+	}
+	if len(o.concurrency) > 0 && cfg.Concurrency == nil {
+		cfg.Concurrency = make(map[string]int, len(o.concurrency))
+	}
+	for agentType, limit := range o.concurrency {
+		cfg.Concurrency[agentType] = limit
+	}
+	return nil
+}
+
+func runCommand(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	graphFile := flags.String("graph", "graph.yaml", "path to the graph definition")
+	var targets stringsFlag
+	flags.Var(&targets, "target", "only run this node and the nodes it depends on; may be repeated")
+	from := flags.String("from", "", "re-execute this node and the nodes depending on it, reusing the results of the others")
+	fromRun := flags.String("from-run", "", "run whose results -from reuses, the latest run of the graph by default")
+	var inputs inputOptions
+	inputs.register(flags)
+	var opts runOptions
+	opts.register(flags)
+	_ = flags.Parse(args)
+
+	values, err := inputs.values()
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+	cfg, err := dag.LoadDAGWithInputs(*graphFile, values)
+	if err != nil {
+		fmt.Println("Failed to load graph:", err)
+		return 1
+	}
+	if err := opts.apply(flags, cfg); err != nil {
+		fmt.Println(err)
+		return 2
+	}
+	if len(targets) > 0 {
+		cfg, err = dag.SelectTargets(cfg, targets)
+		if err != nil {
+			fmt.Println(err)
+			return 2
+		}
+	}
+
+	// Load dGraph into registry
+	dGraph := dag.NewDAG(cfg)
+	if *from != "" {
+		if err := reuseFrom(dGraph, *graphFile, *from, *fromRun, &opts); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+	}
+
+	dGraph.Checkpoint, err = dag.NewCheckpoint(opts.runsDir, *graphFile, targets, cfg.InputValues)
+	if err != nil {
+		fmt.Println("Failed to create run directory:", err)
+		return 1
+	}
+	return execute(dGraph, &opts)
+}
+
+// reuseFrom sets up the DAG to re-execute from the given node, bypassing
+// the cache for it and the nodes depending on it. The other nodes take
+// their results from an earlier run of the same graph; the nodes it
+// depends on can also come from the cache.
+func reuseFrom(dGraph *dag.DAG, graphFile string, from string, fromRun string, opts *runOptions) error {
+	rerun, reuse, err := dag.ReuseFrom(dGraph.Config, from)
+	if err != nil {
+		return err
+	}
+	dGraph.Rerun = rerun
+	dGraph.Reuse = reuse
+
+	var checkpoint *dag.Checkpoint
+	if fromRun != "" {
+		checkpoint, err = dag.OpenCheckpoint(opts.runsDir, fromRun)
+	} else {
+		checkpoint, err = dag.LatestCheckpoint(opts.runsDir, graphFile)
+	}
+	if err != nil {
+		return err
+	}
+	if checkpoint == nil {
+		fmt.Println("No earlier run of this graph, reusing cached results only")
+		return nil
+	}
+
+	restored, changed, err := checkpoint.Restore(dGraph)
+	if err != nil {
+		return err
+	}
+	printChanged(changed)
+	dGraph.Provided = make(map[string]*dag.Result)
+	for agentID, result := range restored {
+		if !rerun[agentID] {
+			dGraph.Provided[agentID] = result
+		}
+	}
+	fmt.Printf("Reusing results of run %s\n", checkpoint.RunId)
+	return nil
+}
+
+func resumeCommand(args []string) int {
+	flags := flag.NewFlagSet("resume", flag.ExitOnError)
+	var opts runOptions
+	opts.register(flags)
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: ai-dag resume [flags] <run-id>")
+		return 2
+	}
+
+	checkpoint, err := dag.OpenCheckpoint(opts.runsDir, flags.Arg(0))
+	if err != nil {
+		fmt.Println("Failed to open run:", err)
+		return 1
+	}
+	cfg, err := dag.LoadDAGWithInputs(checkpoint.Graph, checkpoint.Inputs)
+	if err != nil {
+		fmt.Println("Failed to load graph:", err)
+		return 1
+	}
+	if err := opts.apply(flags, cfg); err != nil {
+		fmt.Println(err)
+		return 2
+	}
+	if len(checkpoint.Targets) > 0 {
+		cfg, err = dag.SelectTargets(cfg, checkpoint.Targets)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+	}
+
+	dGraph := dag.NewDAG(cfg)
+	dGraph.Checkpoint = checkpoint
+	var changed []string
+	dGraph.Provided, changed, err = checkpoint.Restore(dGraph)
+	if err != nil {
+		fmt.Println("Failed to restore run:", err)
+		return 1
+	}
+	printChanged(changed)
+	restored := make([]string, 0, len(dGraph.Provided))
+	for agentID := range dGraph.Provided {
+		restored = append(restored, agentID)
+	}
+	sort.Strings(restored)
+	fmt.Printf("Restored %d completed node(s): %s\n", len(restored), strings.Join(restored, ", "))
+	return execute(dGraph, &opts)
+}
+
+// printChanged reports the nodes of a checkpoint that are executed again
+// because their configuration changed.
+func printChanged(changed []string) {
+	for _, agentID := range changed {
+		fmt.Printf("Configuration of %s changed since the checkpoint, running it again\n", agentID)
+	}
+}
+
+// lingerMetrics keeps the metrics server up for d after a run, so that
+// Prometheus gets to scrape the run's outcome. An interrupt ends the wait.
+func lingerMetrics(addr string, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	fmt.Printf("Serving metrics on %s for %s, interrupt to stop\n", addr, d)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// execute runs the graph, prints its outputs and returns the exit code.
+func execute(dGraph *dag.DAG, opts *runOptions) int {
+	if !opts.noCache {
+		dGraph.Cache = dag.NewCache(opts.cacheDir)
+	}
+	if !opts.quiet {
+		dGraph.Observers = append(dGraph.Observers, dag.NewConsoleObserver(os.Stdout))
+	}
+	if opts.metricsAddr != "" {
+		server, err := metrics.Serve(opts.metricsAddr)
+		if err != nil {
+			fmt.Println("Failed to serve metrics:", err)
+			return 1
+		}
+		defer func() {
+			lingerMetrics(opts.metricsAddr, opts.metricsLinger)
+			server.Close()
+		}()
+		dGraph.Observers = append(dGraph.Observers, dag.NewMetricsObserver())
+	}
+	if opts.eventsFile != "" {
+		events, err := os.OpenFile(opts.eventsFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			fmt.Println("Failed to open events file:", err)
+			return 1
+		}
+		defer events.Close()
+		dGraph.Observers = append(dGraph.Observers, dag.NewJSONLinesObserver(events))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if opts.traceFile != "" {
+		tracer := tracing.NewTracer("ai-dag")
+		ctx = tracing.WithTracer(ctx, tracer)
+		defer func() {
+			if err := tracer.WriteOTLPFile(opts.traceFile); err != nil {
+				fmt.Println("Failed to write trace:", err)
+			}
+		}()
+	}
+
+	if dGraph.Checkpoint != nil {
+		fmt.Printf("Run %s\n", dGraph.Checkpoint.RunId)
+	}
+	result, err := dGraph.Execute(ctx)
+	if dGraph.Checkpoint != nil && result != nil {
+		if err := dGraph.Checkpoint.Finish(result); err != nil {
+			fmt.Printf("Failed to record the results of run %s: %v\n", dGraph.Checkpoint.RunId, err)
+		}
+	}
+	if err != nil {
+		fmt.Println("Run failed:", err)
+		if dGraph.Checkpoint != nil {
+			fmt.Printf("Resume with: ai-dag resume %s\n", dGraph.Checkpoint.RunId)
+		}
+		return 1
+	}
+
+	outputIDs := make([]string, 0, len(result.Outputs))
+	for agentID := range result.Outputs {
+		outputIDs = append(outputIDs, agentID)
+	}
+	sort.Strings(outputIDs)
+	for _, agentID := range outputIDs {
+		fmt.Printf("%s:\n%s\n", agentID, result.Outputs[agentID].Text())
+	}
+	return 0
+}
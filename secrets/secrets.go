@@ -0,0 +1,204 @@
+// Package secrets looks up the API keys and other credentials that graph
+// nodes reference by name with `secret:`, so that agents never read the
+// environment themselves. Where secrets are looked up is set by the
+// graph's `secrets:` list: the environment, a .env file or a directory
+// holding one file per secret.
+package secrets
+
+import (
+	"ai-dag/config"
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Provider kinds, as written in a graph's `secrets:` list.
+const (
+	KindEnv    = "env"
+	KindDotEnv = "dotenv"
+	KindDir    = "dir"
+)
+
+// Provider looks up secrets by name. ok is false when the provider does
+// not have the secret; err is set when it could not be looked up at all.
+type Provider interface {
+	Lookup(name string) (value string, ok bool, err error)
+}
+
+// Env reads secrets from environment variables named after the secret in
+// upper case, e.g. GOOGLE_API_KEY for google_api_key.
+type Env struct{}
+
+func (Env) Lookup(name string) (string, bool, error) {
+	value, ok := os.LookupEnv(envName(name))
+	return value, ok && value != "", nil
+}
+
+// DotEnv reads secrets from a file of KEY=value lines, as written for
+// docker compose and most dotenv libraries. Keys are matched like Env's
+// variable names. A missing file holds no secrets, so that the same graph
+// works where the secrets come from the environment instead.
+type DotEnv struct {
+	Path string
+
+	once   sync.Once
+	values map[string]string
+	err    error
+}
+
+func NewDotEnv(path string) *DotEnv {
+	return &DotEnv{Path: path}
+}
+
+func (d *DotEnv) Lookup(name string) (string, bool, error) {
+	d.once.Do(func() {
+		d.values, d.err = readDotEnv(d.Path)
+	})
+	if d.err != nil {
+		return "", false, d.err
+	}
+	value, ok := d.values[envName(name)]
+	return value, ok && value != "", nil
+}
+
+// readDotEnv parses a .env file. Blank lines and lines starting with #
+// are skipped, an "export " prefix is allowed and values may be wrapped in
+// single or double quotes.
+func readDotEnv(path string) (map[string]string, error) {
+	values := make(map[string]string)
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected KEY=value", path, lineNo)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return values, nil
+}
+
+// Dir reads each secret from the file of the same name in a directory, the
+// way Docker and Kubernetes mount secrets. Trailing newlines are dropped.
+// A missing directory holds no secrets.
+type Dir struct {
+	Path string
+}
+
+func (d Dir) Lookup(name string) (string, bool, error) {
+	if name == "" || name != filepath.Base(name) || name == "." || name == ".." {
+		return "", false, fmt.Errorf("invalid secret name %q", name)
+	}
+	data, err := os.ReadFile(filepath.Join(d.Path, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	value := strings.TrimRight(string(data), "\r\n")
+	return value, value != "", nil
+}
+
+// Chain asks its providers in order and returns the first secret found.
+type Chain []Provider
+
+func (c Chain) Lookup(name string) (string, bool, error) {
+	for _, provider := range c {
+		value, ok, err := provider.Lookup(name)
+		if err != nil || ok {
+			return value, ok, err
+		}
+	}
+	return "", false, nil
+}
+
+// Default is used by graphs without a `secrets:` list.
+var Default Provider = Chain{Env{}}
+
+// New builds the provider described by a graph's `secrets:` list. Relative
+// paths are resolved against baseDir, the directory of the graph file.
+func New(sources []config.SecretSource, baseDir string) (Provider, error) {
+	if len(sources) == 0 {
+		return Default, nil
+	}
+	chain := make(Chain, 0, len(sources))
+	for i, source := range sources {
+		if err := Check(source); err != nil {
+			return nil, fmt.Errorf("secrets[%d]: %w", i, err)
+		}
+		path := source.Path
+		if path != "" && !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		switch source.Provider {
+		case KindEnv:
+			chain = append(chain, Env{})
+		case KindDotEnv:
+			chain = append(chain, NewDotEnv(path))
+		case KindDir:
+			chain = append(chain, Dir{Path: path})
+		}
+	}
+	return chain, nil
+}
+
+// Check reports a `secrets:` entry that names an unknown provider or lacks
+// the path its provider needs.
+func Check(source config.SecretSource) error {
+	switch source.Provider {
+	case KindEnv:
+		if source.Path != "" {
+			return fmt.Errorf("%s provider takes no path", KindEnv)
+		}
+	case KindDotEnv, KindDir:
+		if source.Path == "" {
+			return fmt.Errorf("%s provider needs a path", source.Provider)
+		}
+	default:
+		return fmt.Errorf("unknown provider %q (known providers: %s, %s, %s)", source.Provider, KindEnv, KindDotEnv, KindDir)
+	}
+	return nil
+}
+
+// Get looks up a secret and fails if no provider has it.
+func Get(provider Provider, name string) (string, error) {
+	value, ok, err := provider.Lookup(name)
+	if err != nil {
+		return "", fmt.Errorf("secret %s: %w", name, err)
+	}
+	if !ok {
+		return "", fmt.Errorf("secret %s not found", name)
+	}
+	return value, nil
+}
+
+func envName(name string) string {
+	return strings.ToUpper(name)
+}
@@ -0,0 +1,54 @@
+package tracing
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Transport wraps an http.RoundTripper so that every request made with a
+// traced context gets a client span, ending once the response body is
+// closed. Query strings are left out of the recorded URL since they often
+// carry API keys.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return &transport{base: base}
+}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	_, span := Start(req.Context(), "HTTP "+req.Method, KindClient)
+	if span == nil {
+		return t.base.RoundTrip(req)
+	}
+	span.SetAttribute("http.request.method", req.Method)
+	span.SetAttribute("server.address", req.URL.Hostname())
+	span.SetAttribute("url.full", req.URL.Scheme+"://"+req.URL.Host+req.URL.Path)
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.SetError(err)
+		span.Finish()
+		return nil, err
+	}
+	span.SetAttribute("http.response.status_code", resp.StatusCode)
+	if resp.StatusCode >= 400 {
+		span.SetError(fmt.Errorf("%s", resp.Status))
+	}
+	resp.Body = &spanBody{ReadCloser: resp.Body, span: span}
+	return resp, nil
+}
+
+// spanBody ends the span of a request when its response body is closed.
+type spanBody struct {
+	io.ReadCloser
+	span *Span
+}
+
+func (b *spanBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.span.Finish()
+	return err
+}
@@ -0,0 +1,162 @@
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// The types below follow the JSON encoding of OTLP's
+// ExportTraceServiceRequest: IDs are hex strings and timestamps are
+// nanoseconds since the epoch, as strings.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceId           string          `json:"traceId"`
+	SpanId            string          `json:"spanId"`
+	ParentSpanId      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Links             []otlpLink      `json:"links,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpLink struct {
+	TraceId string `json:"traceId"`
+	SpanId  string `json:"spanId"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// WriteOTLP writes the finished spans as an OTLP JSON trace request.
+func (t *Tracer) WriteOTLP(w io.Writer) error {
+	t.lock.Lock()
+	spans := append([]*Span(nil), t.spans...)
+	t.lock.Unlock()
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].Start.Before(spans[j].Start)
+	})
+
+	scope := otlpScopeSpans{Scope: otlpScope{Name: t.service}, Spans: make([]otlpSpan, 0, len(spans))}
+	for _, span := range spans {
+		scope.Spans = append(scope.Spans, span.otlp())
+	}
+	request := otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: attributes(map[string]interface{}{"service.name": t.service})},
+		ScopeSpans: []otlpScopeSpans{scope},
+	}}}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(request)
+}
+
+// WriteOTLPFile writes the finished spans to the file at path, replacing
+// it.
+func (t *Tracer) WriteOTLPFile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := t.WriteOTLP(file); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (s *Span) otlp() otlpSpan {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	span := otlpSpan{
+		TraceId:           hexId(s.TraceId[:]),
+		SpanId:            hexId(s.SpanId[:]),
+		ParentSpanId:      hexId(s.ParentId[:]),
+		Name:              s.Name,
+		Kind:              s.Kind,
+		StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		Attributes:        attributes(s.Attributes),
+		Status:            otlpStatus{Code: s.StatusCode, Message: s.StatusMessage},
+	}
+	for _, link := range s.Links {
+		span.Links = append(span.Links, otlpLink{TraceId: hexId(link.TraceId[:]), SpanId: hexId(link.SpanId[:])})
+	}
+	return span
+}
+
+// attributes converts a map of attributes to OTLP's typed list, sorted by
+// key.
+func attributes(m map[string]interface{}) []otlpAttribute {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	list := make([]otlpAttribute, 0, len(keys))
+	for _, key := range keys {
+		var value otlpValue
+		switch v := m[key].(type) {
+		case string:
+			value.StringValue = &v
+		case bool:
+			value.BoolValue = &v
+		case int:
+			s := strconv.Itoa(v)
+			value.IntValue = &s
+		case int64:
+			s := strconv.FormatInt(v, 10)
+			value.IntValue = &s
+		case float64:
+			value.DoubleValue = &v
+		default:
+			s := fmt.Sprint(v)
+			value.StringValue = &s
+		}
+		list = append(list, otlpAttribute{Key: key, Value: value})
+	}
+	return list
+}
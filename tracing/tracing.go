@@ -0,0 +1,166 @@
+// Package tracing records spans for runs, nodes and outbound HTTP requests
+// and exports them as OTLP JSON, which trace viewers such as Jaeger can
+// load from a file without a running collector.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Span kinds, as defined by OTLP.
+const (
+	KindInternal = 1
+	KindClient   = 3
+)
+
+// Status codes, as defined by OTLP.
+const (
+	StatusUnset = 0
+	StatusOK    = 1
+	StatusError = 2
+)
+
+// Tracer collects the spans of a process until they are written out.
+type Tracer struct {
+	lock    sync.Mutex
+	service string
+	spans   []*Span
+}
+
+func NewTracer(service string) *Tracer {
+	return &Tracer{service: service}
+}
+
+// Span is a timed operation. All methods are safe to call on a nil *Span,
+// which is what Start returns when tracing is off, so instrumented code does
+// not need to check.
+type Span struct {
+	tracer   *Tracer
+	lock     sync.Mutex
+	TraceId  [16]byte
+	SpanId   [8]byte
+	ParentId [8]byte
+	Name     string
+	Kind     int
+	Start    time.Time
+	End      time.Time
+	// Attributes hold strings, bools, ints, int64s and float64s
+	Attributes    map[string]interface{}
+	Links         []*Span
+	StatusCode    int
+	StatusMessage string
+}
+
+type tracerKey struct{}
+type spanKey struct{}
+
+// WithTracer returns a context under which Start records spans to t.
+func WithTracer(ctx context.Context, t *Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, t)
+}
+
+// Start begins a span as a child of the span in ctx, or as the root of a
+// new trace, and returns a context carrying it. Without a tracer in ctx it
+// returns ctx unchanged and a nil span.
+func Start(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	tracer, _ := ctx.Value(tracerKey{}).(*Tracer)
+	if tracer == nil {
+		return ctx, nil
+	}
+	span := &Span{
+		tracer:     tracer,
+		Name:       name,
+		Kind:       kind,
+		Start:      time.Now(),
+		Attributes: make(map[string]interface{}),
+	}
+	if parent := FromContext(ctx); parent != nil {
+		span.TraceId = parent.TraceId
+		span.ParentId = parent.SpanId
+	} else {
+		randomId(span.TraceId[:])
+	}
+	randomId(span.SpanId[:])
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// FromContext returns the span ctx carries, or nil.
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// SetAttribute records a key-value pair on the span.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.Attributes[key] = value
+}
+
+// AddLink relates the span to another one it is not nested in, e.g. a node
+// to the nodes whose values it consumed.
+func (s *Span) AddLink(other *Span) {
+	if s == nil || other == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.Links = append(s.Links, other)
+}
+
+// SetError marks the span as failed with err; a nil err marks it as
+// successful.
+func (s *Span) SetError(err error) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err != nil {
+		s.StatusCode = StatusError
+		s.StatusMessage = err.Error()
+	} else {
+		s.StatusCode = StatusOK
+	}
+}
+
+// Finish ends the span and hands it to its tracer. Only the first call has
+// an effect.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	if !s.End.IsZero() {
+		s.lock.Unlock()
+		return
+	}
+	s.End = time.Now()
+	s.lock.Unlock()
+
+	s.tracer.lock.Lock()
+	defer s.tracer.lock.Unlock()
+	s.tracer.spans = append(s.tracer.spans, s)
+}
+
+func randomId(id []byte) {
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+}
+
+func hexId(id []byte) string {
+	for _, b := range id {
+		if b != 0 {
+			return hex.EncodeToString(id)
+		}
+	}
+	return ""
+}
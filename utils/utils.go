@@ -1,9 +1,15 @@
 package utils
 
 import (
+	"ai-dag/metrics"
+	"ai-dag/tracing"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os/exec"
+	"strings"
 )
 
 func ExecuteCommandInBash(commandStr string) []byte {
@@ -29,3 +35,115 @@ func ToPrettyJsonFromObject(response interface{}) string {
 	}
 	return string(jsonData)
 }
+
+// ToJSONValue converts v into the generic form encoding/json decodes into
+// (maps, slices, strings, float64s, bools and nil), so that results from
+// different agents can be inspected and stored the same way.
+func ToJSONValue(v interface{}) (interface{}, error) {
+	switch v.(type) {
+	case nil, string, bool, float64:
+		return v, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// ToText renders a result value for humans and prompt templates: strings
+// are used as they are, anything else as indented JSON.
+func ToText(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	}
+	return ToPrettyJsonFromObject(v)
+}
+
+// jsonMap and jsonList print as indented JSON inside templates while still
+// allowing {{.node.key}} and {{index .node 0}} lookups.
+type jsonMap map[string]interface{}
+
+func (m jsonMap) String() string { return ToPrettyJsonFromObject(map[string]interface{}(m)) }
+
+type jsonList []interface{}
+
+func (l jsonList) String() string { return ToPrettyJsonFromObject([]interface{}(l)) }
+
+// ToTemplateData prepares result values for a text/template: top-level maps
+// and lists render as indented JSON with {{.name}}, and their fields can
+// still be reached with {{.name.field}}.
+func ToTemplateData(values map[string]interface{}) map[string]interface{} {
+	data := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			data[key] = jsonMap(v)
+		case []interface{}:
+			data[key] = jsonList(v)
+		default:
+			data[key] = value
+		}
+	}
+	return data
+}
+
+// HTTPClient is the client agents use for outbound requests. Its
+// transport traces every request and counts response statuses.
+var HTTPClient = &http.Client{
+	Transport: tracing.Transport(metrics.Transport(http.DefaultTransport)),
+}
+
+// HTTPError is returned by agents when a service answers with a non-2xx
+// status, so that callers can tell transient failures (429, 5xx) apart.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("unexpected response status: %s", e.Status)
+	}
+	return fmt.Sprintf("unexpected response status: %s: %s", e.Status, e.Body)
+}
+
+// CheckResponse returns an *HTTPError if resp does not have a 2xx status.
+// body is the already read response body, or nil if it was not read.
+func CheckResponse(resp *http.Response, body []byte) error {
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+	return &HTTPError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       string(body),
+	}
+}
+
+// RedactURL drops the query string from the URL quoted by a *url.Error in
+// err, since API keys are often passed there and errors end up in logs,
+// traces and results. Call it on the error a request returned, before
+// wrapping it with fmt.Errorf, which formats the message right away.
+func RedactURL(err error) error {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return err
+	}
+	if u, parseErr := url.Parse(urlErr.URL); parseErr == nil {
+		u.RawQuery = ""
+		u.ForceQuery = false
+		urlErr.URL = u.String()
+	} else {
+		urlErr.URL, _, _ = strings.Cut(urlErr.URL, "?")
+	}
+	return err
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRedactURL(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "query dropped",
+			err:  &url.Error{Op: "Get", URL: "https://api.example.com/v1/x?lat=1&appid=s3cret", Err: errors.New("timeout")},
+			want: `Get "https://api.example.com/v1/x": timeout`,
+		},
+		{
+			name: "chain kept",
+			err:  &url.Error{Op: "Get", URL: "https://a.example.com/?key=s3cret", Err: context.DeadlineExceeded},
+			want: `Get "https://a.example.com/": context deadline exceeded`,
+		},
+		{
+			name: "unparsable URL",
+			err:  &url.Error{Op: "parse", URL: "https://a b.example.com/?key=s3cret", Err: errors.New("invalid character")},
+			want: `parse "https://a b.example.com/": invalid character`,
+		},
+		{
+			name: "other errors unchanged",
+			err:  errors.New("key=s3cret"),
+			want: "key=s3cret",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := RedactURL(test.err).Error(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+	if err := RedactURL(&url.Error{Op: "Get", URL: "https://a.example.com/?k=v", Err: context.DeadlineExceeded}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("RedactURL broke the error chain: %v", err)
+	}
+	if RedactURL(nil) != nil {
+		t.Error("RedactURL(nil) != nil")
+	}
+}
+
+func TestRedactURLRequestErrors(t *testing.T) {
+	_, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://a\x7f.example.com/?key=s3cret", nil)
+	if err == nil {
+		t.Fatal("expected a parse error")
+	}
+	if got := RedactURL(err).Error(); strings.Contains(got, "s3cret") {
+		t.Errorf("secret in %q", got)
+	}
+}
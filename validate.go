@@ -0,0 +1,28 @@
+package main
+
+import (
+	"ai-dag/dag"
+	"flag"
+	"fmt"
+)
+
+func validateCommand(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	graphFile := flags.String("graph", "graph.yaml", "path to the graph definition")
+	_ = flags.Parse(args)
+
+	problems, err := dag.Validate(*graphFile)
+	if err != nil {
+		fmt.Println("Failed to validate graph:", err)
+		return 1
+	}
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		fmt.Printf("%d problem(s) found\n", len(problems))
+		return 1
+	}
+	fmt.Printf("%s is valid\n", *graphFile)
+	return 0
+}